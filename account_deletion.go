@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// accountDeletionGracePeriod is how long a user has to change their mind
+// after asking for their account to be deleted.
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// deletionReason is the account state transition reason of accounts their
+// owner asked to delete.
+const deletionReason = "deletion requested by the user"
+
+// handlerDeleteAccount schedules the user's account for deletion. The account
+// is deactivated at once and deleted when the grace period ends, unless the
+// user restores it first. The user confirms with their password or a passkey,
+// unless they have just logged in with an email link or a passkey.
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	claims, err := auth.ParseJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+	userId, err := claims.UserID()
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := confirmation{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected password or a passkey, got: %v", err))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if !recentPasswordlessLogin(claims) && !cfg.confirmIdentity(w, r, usr, params) {
+		return
+	}
+
+	deleteAfter := time.Now().Add(accountDeletionGracePeriod)
+	restoreToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create restore link: %v", err))
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// deactivating the account revokes its sessions
+	if _, err := setAccountState(r.Context(), qtx, usr, accountDeactivated, deletionReason, sql.NullTime{}, userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to deactivate account: %v", err))
+		return
+	}
+	if err := qtx.SetDeleteAfter(r.Context(), database.SetDeleteAfterParams{ID: userId, DeleteAfter: sql.NullTime{Time: deleteAfter, Valid: true}}); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to schedule deletion: %v", err))
+		return
+	}
+	if err := qtx.DeleteAccountRestoreTokensByUser(r.Context(), userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create restore link: %v", err))
+		return
+	}
+	err = qtx.CreateAccountRestoreToken(r.Context(), database.CreateAccountRestoreTokenParams{
+		TokenHash: hashToken(restoreToken),
+		UserID:    userId,
+		ExpiresAt: deleteAfter,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create restore link: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditDeletionRequested, userId, userId, map[string]any{"delete_after": deleteAfter})
+
+	link := cfg.publicURL + "/api/users/restore?token=" + url.QueryEscape(restoreToken)
+	err = cfg.mailer.Send(r.Context(), mailer.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Text: fmt.Sprintf("Your Chirpy account is deactivated and will be deleted on %s.\n\n"+
+			"If you change your mind, open this link before then to restore it:\n\n%s\n\nThe link works once.\n",
+			deleteAfter.UTC().Format(time.RFC1123), link),
+	})
+	if err != nil {
+		log.Printf("failed to email user %s about deletion: %v", userId, err)
+	}
+
+	WriteJSON(w, http.StatusAccepted, response{DeleteAfter: deleteAfter})
+}
+
+// handlerRestoreAccountPage is where restore links point. Restoring takes a
+// second step so mail scanners that open links do not use them up.
+func (cfg *apiConfig) handlerRestoreAccountPage(w http.ResponseWriter, r *http.Request) {
+	renderRestorePage(w, http.StatusOK, restorePage{Token: r.URL.Query().Get("token")})
+}
+
+// handlerRestoreAccount cancels a pending deletion. The account's tokens were
+// revoked, so the user proves who they are with the link emailed when they
+// asked for the deletion, or with their email and password. The form on the
+// link's page gets HTML back instead of JSON.
+func (cfg *apiConfig) handlerRestoreAccount(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	fromForm := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if fromForm {
+		params.Token = r.PostFormValue("token")
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected token, or email and password, got: %v", err))
+		return
+	}
+
+	var usr database.User
+	var ok bool
+	if fromForm || params.Token != "" {
+		usr, ok = cfg.checkRestoreToken(w, r, fromForm, params.Token)
+	} else {
+		usr, ok = cfg.checkRestorePassword(w, r, params.Email, params.Password)
+	}
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	usr, err = qtx.GetUserByIDForUpdate(r.Context(), usr.ID)
+	if err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	transitions, err := qtx.GetAccountStateTransitions(r.Context(), usr.ID)
+	if err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to get account state: %v", err))
+		return
+	}
+	// accounts deactivated by staff stay deactivated, and shadowbans survive
+	// the deletion request
+	state, expiresAt, ok := stateBeforeDeletion(usr, transitions)
+	if !ok {
+		writeRestoreError(w, fromForm, http.StatusConflict, errors.New("account is not scheduled for deletion"))
+		return
+	}
+
+	if _, err := setAccountState(r.Context(), qtx, usr, state, "deletion cancelled by the user", expiresAt, usr.ID); err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to restore account: %v", err))
+		return
+	}
+	if err := qtx.SetDeleteAfter(r.Context(), database.SetDeleteAfterParams{ID: usr.ID}); err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to cancel deletion: %v", err))
+		return
+	}
+	if err := qtx.DeleteAccountRestoreTokensByUser(r.Context(), usr.ID); err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to cancel deletion: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditDeletionCancelled, usr.ID, usr.ID, nil)
+
+	if fromForm {
+		renderRestorePage(w, http.StatusOK, restorePage{Restored: true})
+		return
+	}
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// purgeDeletedAccounts deletes accounts whose grace period has ended every
+// interval until ctx is done.
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	const batchSize = 100
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			users, err := cfg.db.GetUsersDueForDeletion(ctx, batchSize)
+			if err != nil {
+				log.Printf("failed to get accounts due for deletion: %v", err)
+				continue
+			}
+			for _, usr := range users {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := cfg.deleteAccount(ctx, usr); err != nil {
+					log.Printf("failed to delete account %s: %v", usr.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// helpers ---------------------------------------------------------
+
+// checkRestoreToken uses up a restore link's token and returns its account.
+// It writes the response and returns false when the link is refused.
+func (cfg *apiConfig) checkRestoreToken(w http.ResponseWriter, r *http.Request, fromForm bool, token string) (database.User, bool) {
+	restore, err := cfg.db.ConsumeAccountRestoreToken(r.Context(), hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeRestoreError(w, fromForm, http.StatusUnauthorized, errors.New("restore link is invalid or has already been used"))
+		return database.User{}, false
+	} else if err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to check restore link: %v", err))
+		return database.User{}, false
+	}
+	if time.Now().After(restore.ExpiresAt) {
+		writeRestoreError(w, fromForm, http.StatusUnauthorized, errors.New("restore link has expired"))
+		return database.User{}, false
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), restore.UserID)
+	if err != nil {
+		writeRestoreError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return database.User{}, false
+	}
+	return usr, true
+}
+
+// checkRestorePassword checks a restore's email and password like a login.
+// It writes the response and returns false when they are wrong.
+func (cfg *apiConfig) checkRestorePassword(w http.ResponseWriter, r *http.Request, email, password string) (database.User, bool) {
+	attempt, retryAt, err := cfg.reserveLoginAttempt(r, email)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to check login attempts: %v", err))
+		return database.User{}, false
+	}
+	if !retryAt.IsZero() {
+		setRetryAfter(w, retryAt)
+		WriteError(w, http.StatusTooManyRequests, errors.New("too many failed login attempts, try again later"))
+		return database.User{}, false
+	}
+
+	usr, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.CheckDummyPassword(password)
+		cfg.recordLoginFailure(r, attempt, nil)
+		WriteError(w, http.StatusUnauthorized, errors.New("incorrect email or password"))
+		return database.User{}, false
+	} else if err != nil {
+		cfg.releaseLoginAttempt(r.Context(), attempt)
+		WriteError(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return database.User{}, false
+	}
+	if err := auth.CheckPasswordHash(password, usr.HashedPassword); err != nil {
+		cfg.recordLoginFailure(r, attempt, &usr)
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": "wrong password", "method": "restore"})
+		WriteError(w, http.StatusUnauthorized, errors.New("incorrect email or password"))
+		return database.User{}, false
+	}
+	cfg.clearLoginThrottle(r.Context(), attempt)
+	return usr, true
+}
+
+type restorePage struct {
+	Token    string
+	Error    string
+	Restored bool
+}
+
+// writeRestoreError responds to a failed restore with the error as JSON, or
+// on the restore link's page when the page's form was used.
+func writeRestoreError(w http.ResponseWriter, fromForm bool, status int, err error) {
+	if !fromForm {
+		WriteError(w, status, err)
+		return
+	}
+	renderRestorePage(w, status, restorePage{Error: err.Error()})
+}
+
+func renderRestorePage(w http.ResponseWriter, status int, page restorePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := accountTemplates.ExecuteTemplate(w, "restore.html", page); err != nil {
+		log.Printf("failed to render restore.html: %v", err)
+	}
+}
+
+// stateBeforeDeletion returns the state the account was in when its owner
+// asked to delete it, and when that state ends. ok is false when no deletion
+// is pending or staff have changed the account's state since the request.
+func stateBeforeDeletion(usr database.User, transitions []database.AccountStateTransition) (state string, expiresAt sql.NullTime, ok bool) {
+	if !usr.DeleteAfter.Valid || accountState(usr) != accountDeactivated || len(transitions) == 0 {
+		return "", sql.NullTime{}, false
+	}
+	// transitions are newest first
+	request := transitions[0]
+	if request.ToState != accountDeactivated || request.Reason != deletionReason || request.ActorID.UUID != usr.ID {
+		return "", sql.NullTime{}, false
+	}
+
+	state = request.FromState
+	// a shadowban keeps the end it had before the request
+	if state != accountActive && len(transitions) > 1 && transitions[1].ToState == state {
+		expiresAt = transitions[1].ExpiresAt
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return accountActive, sql.NullTime{}, true
+	}
+	return state, expiresAt, true
+}
+
+// deleteAccount deletes a user and everything they own. Audit events,
+// reports and moderation actions are kept, as they must be, with the
+// personal data in them removed.
+func (cfg *apiConfig) deleteAccount(ctx context.Context, usr database.User) error {
+	exports, err := cfg.db.GetDataExportsByUser(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.FilePath == "" {
+			continue
+		}
+		if err := os.Remove(export.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.ClearLoginThrottle(ctx, accountThrottleKey(usr.Email)); err != nil {
+		return err
+	}
+	if err := qtx.AnonymizeReports(ctx, usr.ID); err != nil {
+		return err
+	}
+	// everything else the user owns goes with them
+	if err := qtx.DeleteUser(ctx, usr.ID); err != nil {
+		return err
+	}
+	// the audit trigger only lets events be scrubbed once the user is gone
+	err = qtx.AnonymizeAuditEvents(ctx, database.AnonymizeAuditEventsParams{
+		KeepKeys:      anonymousAuditKeys,
+		ReasonActions: fixedReasonActions,
+		UserID:        uuid.NullUUID{UUID: usr.ID, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	err = qtx.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		Action:   auditAccountDeleted,
+		TargetID: uuid.NullUUID{UUID: usr.ID, Valid: true},
+		Metadata: []byte("{}"),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	accountActive       = "active"
+	accountSuspended    = "suspended"
+	accountShadowbanned = "shadowbanned"
+	accountDeactivated  = "deactivated"
+)
+
+type AccountState struct {
+	State       string                   `json:"state"`
+	ExpiresAt   *time.Time               `json:"expires_at"`
+	Transitions []AccountStateTransition `json:"transitions"`
+}
+
+type AccountStateTransition struct {
+	ID        uuid.UUID  `json:"id"`
+	FromState string     `json:"from_state"`
+	ToState   string     `json:"to_state"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	ActorID   *uuid.UUID `json:"actor_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerGetAccountState(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse user id: %v", err))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("user not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+
+	resp, err := cfg.getAccountState(r.Context(), usr)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get account state: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerSetAccountState(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		State            string `json:"state"`
+		Reason           string `json:"reason"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+	const maxReasonLength = 500
+
+	adminId := userIDFromContext(r.Context())
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse user id: %v", err))
+		return
+	}
+	if userId == adminId {
+		WriteError(w, http.StatusBadRequest, errors.New("cannot change your own account state"))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected state and reason, got: %v", err))
+		return
+	}
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		WriteError(w, http.StatusBadRequest, errors.New("reason is required"))
+		return
+	}
+	if len(reason) > maxReasonLength {
+		WriteError(w, http.StatusBadRequest, errors.New("reason is too long"))
+		return
+	}
+	if params.ExpiresInSeconds < 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("expires_in_seconds cannot be negative"))
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInSeconds > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(params.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+	switch params.State {
+	case accountSuspended:
+		if !expiresAt.Valid {
+			WriteError(w, http.StatusBadRequest, errors.New("suspensions require expires_in_seconds. deactivate the account instead"))
+			return
+		}
+	case accountShadowbanned:
+	case accountActive, accountDeactivated:
+		if expiresAt.Valid {
+			WriteError(w, http.StatusBadRequest, fmt.Errorf("%s accounts do not expire", params.State))
+			return
+		}
+	default:
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid state %q. expected active, suspended, shadowbanned or deactivated", params.State))
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	usr, err := qtx.GetUserByIDForUpdate(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("user not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	// the deletion goes ahead whatever staff do in the grace period, so the
+	// account must stay unusable until then. deactivating it keeps its owner
+	// from restoring it
+	if usr.DeleteAfter.Valid && params.State != accountDeactivated {
+		WriteError(w, http.StatusConflict, fmt.Errorf("account is scheduled for deletion on %s. it can only be deactivated", usr.DeleteAfter.Time.UTC().Format(time.RFC3339)))
+		return
+	}
+
+	fromState := accountState(usr)
+	usr, err = setAccountState(r.Context(), qtx, usr, params.State, reason, expiresAt, adminId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update account state: %v", err))
+		return
+	}
+	if params.State == accountSuspended {
+		message := fmt.Sprintf("Your account has been suspended until %s.", expiresAt.Time.UTC().Format(time.RFC1123))
+		if err := notify(r.Context(), qtx, usr.ID, notificationSuspension, message); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to notify user: %v", err))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+		return
+	}
+	metadata := map[string]any{"from": fromState, "to": params.State, "reason": reason}
+	if expiresAt.Valid {
+		metadata["expires_at"] = expiresAt.Time
+	}
+	cfg.recordAudit(r, auditAccountStateChange, adminId, userId, metadata)
+
+	resp, err := cfg.getAccountState(r.Context(), usr)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get account state: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// helpers ---------------------------------------------------------
+
+// accountState returns the state currently in effect. Suspensions and
+// shadowbans that have run out read as active.
+func accountState(usr database.User) string {
+	if usr.StateExpiresAt.Valid && !usr.StateExpiresAt.Time.After(time.Now()) {
+		return accountActive
+	}
+	return usr.AccountState
+}
+
+// checkAccountUsable returns an error for accounts that may not log in or use
+// their tokens. Shadowbanned accounts are usable so the ban is not revealed.
+func checkAccountUsable(usr database.User) error {
+	switch accountState(usr) {
+	case accountSuspended:
+		return fmt.Errorf("account suspended until %s", usr.StateExpiresAt.Time.UTC().Format(time.RFC3339))
+	case accountDeactivated:
+		if usr.DeleteAfter.Valid {
+			return fmt.Errorf("account scheduled for deletion on %s. restore it with POST /api/users/restore", usr.DeleteAfter.Time.UTC().Format(time.RFC3339))
+		}
+		return errors.New("account deactivated")
+	}
+	return nil
+}
+
+// checkTokenCurrent returns an error for access tokens issued before the
+// user's sessions were last revoked.
+func checkTokenCurrent(usr database.User, claims *auth.Claims) error {
+	if !usr.TokensValidAfter.Valid || claims.IssuedAt == nil {
+		return nil
+	}
+	// iat only has whole seconds, so tokens issued in the second of the
+	// revocation, like the caller's new ones, are still accepted
+	if claims.IssuedAt.Time.Before(usr.TokensValidAfter.Time.Truncate(time.Second)) {
+		return errors.New("token has been revoked")
+	}
+	return nil
+}
+
+// setAccountState moves the user to a new state and records the transition.
+// Sessions are revoked when the account can no longer be used.
+func setAccountState(ctx context.Context, q *database.Queries, usr database.User, state, reason string, expiresAt sql.NullTime, actorID uuid.UUID) (database.User, error) {
+	updated, err := q.SetAccountState(ctx, database.SetAccountStateParams{
+		ID:             usr.ID,
+		AccountState:   state,
+		StateExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = q.CreateAccountStateTransition(ctx, database.CreateAccountStateTransitionParams{
+		UserID:    usr.ID,
+		FromState: accountState(usr),
+		ToState:   state,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+		ActorID:   uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if checkAccountUsable(updated) != nil {
+		if err := q.RevokeUserTokens(ctx, usr.ID); err != nil {
+			return database.User{}, err
+		}
+	}
+	return updated, nil
+}
+
+func (cfg *apiConfig) getAccountState(ctx context.Context, usr database.User) (AccountState, error) {
+	transitions, err := cfg.db.GetAccountStateTransitions(ctx, usr.ID)
+	if err != nil {
+		return AccountState{}, err
+	}
+
+	resp := AccountState{
+		State:       accountState(usr),
+		Transitions: []AccountStateTransition{},
+	}
+	if resp.State != accountActive && usr.StateExpiresAt.Valid {
+		resp.ExpiresAt = &usr.StateExpiresAt.Time
+	}
+	for _, t := range transitions {
+		transition := AccountStateTransition{
+			ID:        t.ID,
+			FromState: t.FromState,
+			ToState:   t.ToState,
+			Reason:    t.Reason,
+			ActorID:   nullUUID(t.ActorID),
+			CreatedAt: t.CreatedAt,
+		}
+		if t.ExpiresAt.Valid {
+			transition.ExpiresAt = &t.ExpiresAt.Time
+		}
+		resp.Transitions = append(resp.Transitions, transition)
+	}
+	return resp, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const adminRecentChirps = 20
+
+type AdminUser struct {
+	User
+	AccountState          string `json:"account_state"`
+	PasswordResetRequired bool   `json:"password_reset_required"`
+}
+
+type AdminUserDetail struct {
+	AdminUser
+	Sessions []Session `json:"sessions"`
+	Chirps   []Chirp   `json:"chirps"`
+}
+
+// Session is an unrevoked refresh token. The token itself is never shown.
+type Session struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (cfg *apiConfig) handlerAdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	users, err := cfg.searchUsers(r.Context(), r.URL.Query().Get("email"), limit, offset)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve users: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) handlerAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	detail, err := cfg.getAdminUserDetail(r.Context(), usr)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user details: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, detail)
+}
+
+func (cfg *apiConfig) handlerAdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.revokeSessions(r, usr); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to revoke sessions: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerAdminForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.forcePasswordReset(r, usr); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to force password reset: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerAdminSetChirpyRed(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		IsChirpyRed bool `json:"is_chirpy_red"`
+	}
+
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected is_chirpy_red, got: %v", err))
+		return
+	}
+
+	usr, err := cfg.setChirpyRed(r, usr, params.IsChirpyRed)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update user: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, adminUserFromDB(usr))
+}
+
+// helpers ---------------------------------------------------------
+
+// getPathUser loads the user named by the userId path value, writing the
+// error response if there is none.
+func (cfg *apiConfig) getPathUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse user id: %v", err))
+		return database.User{}, false
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("user not found"))
+		return database.User{}, false
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return database.User{}, false
+	}
+	return usr, true
+}
+
+func (cfg *apiConfig) searchUsers(ctx context.Context, email string, limit, offset int32) ([]AdminUser, error) {
+	// the search is a substring match, so LIKE wildcards typed by the admin are taken literally
+	query := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(email))
+
+	dbUsers, err := cfg.db.SearchUsers(ctx, database.SearchUsersParams{Query: query, PageLimit: limit, PageOffset: offset})
+	if err != nil {
+		return nil, err
+	}
+
+	users := []AdminUser{}
+	for _, usr := range dbUsers {
+		users = append(users, adminUserFromDB(usr))
+	}
+	return users, nil
+}
+
+func (cfg *apiConfig) getAdminUserDetail(ctx context.Context, usr database.User) (AdminUserDetail, error) {
+	detail := AdminUserDetail{
+		AdminUser: adminUserFromDB(usr),
+		Sessions:  []Session{},
+		Chirps:    []Chirp{},
+	}
+
+	tokens, err := cfg.db.GetActiveRefreshTokens(ctx, usr.ID)
+	if err != nil {
+		return AdminUserDetail{}, err
+	}
+	for _, token := range tokens {
+		session := Session{CreatedAt: token.CreatedAt}
+		if token.ExpiresAt.Valid {
+			session.ExpiresAt = &token.ExpiresAt.Time
+		}
+		detail.Sessions = append(detail.Sessions, session)
+	}
+
+	chirps, err := cfg.db.GetChirpsByAuthor(ctx, database.GetChirpsByAuthorParams{UserID: usr.ID, Limit: adminRecentChirps})
+	if err != nil {
+		return AdminUserDetail{}, err
+	}
+	for _, chirp := range chirps {
+		detail.Chirps = append(detail.Chirps, chirpFromDB(chirp))
+	}
+
+	return detail, nil
+}
+
+// revokeSessions ends the user's refresh tokens. Access tokens already handed
+// out stay valid until they expire.
+func (cfg *apiConfig) revokeSessions(r *http.Request, usr database.User) error {
+	if err := cfg.db.RevokeUserTokens(r.Context(), usr.ID); err != nil {
+		return err
+	}
+	cfg.recordAudit(r, auditSessionsRevoked, userIDFromContext(r.Context()), usr.ID, nil)
+	return nil
+}
+
+// forcePasswordReset revokes the user's sessions and blocks their access
+// tokens until they choose a new password.
+func (cfg *apiConfig) forcePasswordReset(r *http.Request, usr database.User) error {
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.RequirePasswordReset(r.Context(), usr.ID); err != nil {
+		return err
+	}
+	if err := qtx.RevokeUserTokens(r.Context(), usr.ID); err != nil {
+		return err
+	}
+	message := "An administrator has required you to choose a new password. Log in and update your password to continue."
+	if err := notify(r.Context(), qtx, usr.ID, notificationPasswordReset, message); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	cfg.recordAudit(r, auditPasswordResetForced, userIDFromContext(r.Context()), usr.ID, nil)
+	return nil
+}
+
+func (cfg *apiConfig) setChirpyRed(r *http.Request, usr database.User, isChirpyRed bool) (database.User, error) {
+	var err error
+	if isChirpyRed {
+		err = cfg.db.UpgradeUserToChirpyRed(r.Context(), usr.ID)
+	} else {
+		err = cfg.db.DowngradeUserFromChirpyRed(r.Context(), usr.ID)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	cfg.recordAudit(r, auditChirpyRedChanged, userIDFromContext(r.Context()), usr.ID, map[string]any{
+		"from":   usr.IsChirpyRed,
+		"to":     isChirpyRed,
+		"source": "admin",
+	})
+
+	usr.IsChirpyRed = isChirpyRed
+	return usr, nil
+}
+
+func adminUserFromDB(usr database.User) AdminUser {
+	return AdminUser{
+		User: User{
+			ID:          usr.ID,
+			CreatedAt:   usr.CreatedAt,
+			UpdatedAt:   usr.UpdatedAt,
+			Email:       usr.Email,
+			IsChirpyRed: usr.IsChirpyRed,
+			Role:        usr.Role,
+		},
+		AccountState:          accountState(usr),
+		PasswordResetRequired: usr.PasswordResetRequired,
+	}
+}
@@ -1,20 +1,63 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"sync"
 	"sync/atomic"
 
+	"github.com/chaeanthony/chirpy/internal/auth"
 	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/filter"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+	"github.com/chaeanthony/chirpy/internal/oidc"
+	"github.com/chaeanthony/chirpy/internal/ratelimit"
+	"github.com/chaeanthony/chirpy/internal/spam"
+	"github.com/google/uuid"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db *database.Queries
+	dbConn *sql.DB
 	platform string
 	jwtSecret string
 	polkaKey string
+	// filterRules come from the word list file, chirpFilter adds the rules
+	// stored in the database. The server changing a rule reloads it at once,
+	// others within a minute
+	filterRules []filter.Rule
+	chirpFilter atomic.Pointer[filter.Filter]
+	spam *spam.Pipeline
+	spamConfig spam.Config
+	rateLimiter ratelimit.Store
+	passwordPolicy auth.PasswordPolicy
+	// oidcProviders are the external login providers by name
+	oidcProviders map[string]*oidc.Provider
+	mailer mailer.Mailer
+	// publicURL is where users reach the server, for links in emails
+	publicURL string
+	relyingParty auth.RelyingParty
+	// trustedProxies are the reverse proxies whose X-Forwarded-For is believed
+	trustedProxies []netip.Prefix
+	// exportDir holds finished data exports until they expire
+	exportDir string
+	// background tracks the workers and the work handlers leave running after
+	// they respond, so shutdown can wait for it
+	background sync.WaitGroup
+}
+
+// goBackground runs f in a goroutine that shutdown waits for.
+func (cfg *apiConfig) goBackground(f func()) {
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		f()
+	}()
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -24,6 +67,136 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// middlewareAccountState rejects requests made with the access token of a
+// suspended or deactivated account. Requests without an access token are left
+// for the handlers to deal with.
+func (cfg *apiConfig) middlewareAccountState(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// refresh tokens are not JWTs, the refresh handler checks the account itself
+		claims, err := auth.ParseJWT(token, cfg.jwtSecret)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		usr, err := cfg.db.GetUserByID(r.Context(), userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusUnauthorized, errors.New("user not found"))
+			return
+		} else if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+			return
+		}
+		if err := checkAccountUsable(usr); err != nil {
+			WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		if err := checkTokenCurrent(usr, claims); err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		// the only thing a user who must reset their password can do is change it
+		if usr.PasswordResetRequired && !(r.Method == http.MethodPut && r.URL.Path == "/api/users/me/password") {
+			WriteError(w, http.StatusForbidden, errors.New("password reset required. choose a new password with PUT /api/users/me/password"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type contextKey string
+
+const contextKeyClaims contextKey = "claims"
+
+// middlewareRequireRole only lets requests through whose access token carries
+// at least the given role. The role is checked again against the database so
+// a demotion takes effect before the user's token expires.
+func (cfg *apiConfig) middlewareRequireRole(role auth.Role, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		fromCookie := err != nil
+		if err != nil {
+			// the admin dashboard keeps its token in a cookie
+			cookie, cookieErr := r.Cookie(adminCookieName)
+			if cookieErr != nil {
+				WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+				WriteError(w, http.StatusForbidden, errors.New("cross-origin request refused"))
+				return
+			}
+			token = cookie.Value
+		}
+		claims, err := auth.ParseJWT(token, cfg.jwtSecret)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+			return
+		}
+		// OAuth clients never act with a user's staff powers
+		if claims.Delegated() {
+			WriteError(w, http.StatusForbidden, errors.New("OAuth access tokens cannot be used here"))
+			return
+		}
+		if !claims.Role.Allows(role) {
+			WriteError(w, http.StatusForbidden, fmt.Errorf("%s access required", role))
+			return
+		}
+
+		userId, err := claims.UserID()
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+			return
+		}
+		usr, err := cfg.db.GetUserByID(r.Context(), userId)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, fmt.Errorf("failed to get user: %v", err))
+			return
+		}
+		if !auth.Role(usr.Role).Allows(role) {
+			WriteError(w, http.StatusForbidden, fmt.Errorf("%s access required", role))
+			return
+		}
+		if err := checkAccountUsable(usr); err != nil {
+			WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		if err := checkTokenCurrent(usr, claims); err != nil {
+			WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		// middlewareAccountState only sees bearer tokens
+		if fromCookie && usr.PasswordResetRequired {
+			WriteError(w, http.StatusForbidden, errors.New("password reset required. choose a new password with PUT /api/users/me/password"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyClaims, claims)))
+	})
+}
+
+// userIDFromContext returns the user authenticated by middlewareRequireRole.
+func userIDFromContext(ctx context.Context) uuid.UUID {
+	claims, ok := ctx.Value(contextKeyClaims).(*auth.Claims)
+	if !ok {
+		return uuid.Nil
+	}
+	id, _ := claims.UserID()
+	return id
+}
+
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -42,12 +215,15 @@ func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
 		WriteError(w, http.StatusForbidden, errors.New("endpoint forbidden"))
+		return
 	}
+	if err := cfg.db.DeleteUsers(r.Context()); err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cfg.recordAudit(r, auditAdminReset, userIDFromContext(r.Context()), uuid.Nil, map[string]any{"hits": cfg.fileserverHits.Load()})
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	cfg.fileserverHits.Store(0)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0. Deleted all users."))
-	if err := cfg.db.DeleteUsers(r.Context()); err != nil {
-		WriteError(w, http.StatusInternalServerError, err)
-	}
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	auditLogin                  = "user.login"
+	auditLoginFailed            = "user.login_failed"
+	auditLockedOut              = "user.locked_out"
+	auditPasswordChanged        = "user.password_changed"
+	auditEmailChangeRequested   = "user.email_change_requested"
+	auditEmailChanged           = "user.email_changed"
+	auditTokenRevoked           = "token.revoked"
+	auditChirpyRedUpgraded      = "user.chirpy_red_upgraded"
+	auditChirpyRedChanged       = "user.chirpy_red_changed"
+	auditSessionsRevoked        = "user.sessions_revoked"
+	auditPasswordResetForced    = "user.password_reset_forced"
+	auditRoleChanged            = "user.role_changed"
+	auditAccountStateChange     = "user.account_state_changed"
+	auditIdentityLinked         = "user.identity_linked"
+	auditIdentityUnlinked       = "user.identity_unlinked"
+	auditPasskeyAdded           = "user.passkey_added"
+	auditPasskeyRemoved         = "user.passkey_removed"
+	auditPasskeyRequiredChanged = "user.passkey_required_changed"
+	auditDataExportRequested    = "user.data_export_requested"
+	auditDeletionRequested      = "user.deletion_requested"
+	auditDeletionCancelled      = "user.deletion_cancelled"
+	auditAccountDeleted         = "user.deleted"
+	auditImpersonationStarted   = "admin.impersonation_started"
+	auditImpersonatedRequest    = "admin.impersonated_request"
+	auditAdminReset             = "admin.reset"
+)
+
+// anonymousAuditKeys are the metadata keys that say nothing about a person.
+// Deleting an account removes every other key from its audit events, so
+// keys added later are removed until they are listed here.
+var anonymousAuditKeys = []string{
+	"client_id", "delete_after", "event", "expires_at", "export_id", "failures",
+	"from", "grant_id", "had_password", "hits", "locked_for_seconds", "method",
+	"passkey_id", "path", "personal_access_token_id", "provider", "purpose",
+	"report_id", "required", "reset", "scopes", "second_factor", "source",
+	"suspend_hours", "to",
+}
+
+// fixedReasonActions are the actions whose reason is one of a few fixed
+// codes. Other reasons are typed by people and removed with the account.
+var fixedReasonActions = []string{auditLoginFailed, auditLockedOut}
+
+type AuditEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	Action    string          `json:"action"`
+	ActorID   *uuid.UUID      `json:"actor_id"`
+	TargetID  *uuid.UUID      `json:"target_id"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerGetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	const exportPageSize = 500
+	// each page of an export gets this long to be written, in place of the
+	// server's write timeout which would cut a long export short
+	const exportPageTimeout = time.Minute
+
+	query := r.URL.Query()
+	params := database.GetAuditEventsParams{Action: query.Get("action")}
+
+	var err error
+	if params.ActorID, err = parseNullUUID(query.Get("actor_id")); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse actor_id: %v", err))
+		return
+	}
+	if params.TargetID, err = parseNullUUID(query.Get("target_id")); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse target_id: %v", err))
+		return
+	}
+	if params.Since, err = parseNullTime(query.Get("since")); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse since. expected RFC 3339 time: %v", err))
+		return
+	}
+	if params.Until, err = parseNullTime(query.Get("until")); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse until. expected RFC 3339 time: %v", err))
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+	case "jsonl":
+		// pin the end of the export so events recorded meanwhile don't shift the pages
+		if !params.Until.Valid {
+			params.Until = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		params.PageLimit = exportPageSize
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		enc := json.NewEncoder(w)
+		rc := http.NewResponseController(w)
+		for {
+			if err := rc.SetWriteDeadline(time.Now().Add(exportPageTimeout)); err != nil {
+				log.Printf("failed to extend write deadline of audit export: %v", err)
+			}
+			events, err := cfg.db.GetAuditEvents(r.Context(), params)
+			if err != nil {
+				// the status line is already sent, so all we can do is cut the export short
+				log.Printf("audit export failed: %v", err)
+				return
+			}
+			for _, event := range events {
+				if err := enc.Encode(auditEventFromDB(event)); err != nil {
+					return
+				}
+			}
+			if len(events) < exportPageSize {
+				return
+			}
+			params.PageOffset += exportPageSize
+		}
+	default:
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q. expected json or jsonl", query.Get("format")))
+		return
+	}
+
+	params.PageLimit, params.PageOffset, err = parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dbEvents, err := cfg.db.GetAuditEvents(r.Context(), params)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve audit events: %v", err))
+		return
+	}
+
+	events := []AuditEvent{}
+	for _, event := range dbEvents {
+		events = append(events, auditEventFromDB(event))
+	}
+
+	WriteJSON(w, http.StatusOK, events)
+}
+
+// helpers ---------------------------------------------------------
+
+// recordAudit appends an event to the audit log. Failing to record is logged
+// rather than failing the request it describes.
+func (cfg *apiConfig) recordAudit(r *http.Request, action string, actorID, targetID uuid.UUID, metadata map[string]any) {
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("failed to encode audit metadata for %s: %v", action, err)
+		data = []byte("{}")
+	}
+
+	err = cfg.db.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		Action:    action,
+		ActorID:   uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		TargetID:  uuid.NullUUID{UUID: targetID, Valid: targetID != uuid.Nil},
+		Ip:        cfg.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Metadata:  data,
+	})
+	if err != nil {
+		log.Printf("failed to record audit event %s: %v", action, err)
+	}
+}
+
+// auditEmailHash stands in for an email that belongs to no account. Events
+// without a user are never anonymized, so they must not hold the email
+// itself; the keyed hash still ties together failed logins for one email.
+func (cfg *apiConfig) auditEmailHash(email string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	mac.Write([]byte("audit-email:" + strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// clientIP returns the address of the client that made the request. Behind
+// trusted proxies it is the last address in X-Forwarded-For that is not one of
+// them, since each proxy appends the address it got the request from and
+// anything before that could have been sent by the client.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !cfg.trustedProxy(addr) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !cfg.trustedProxy(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func (cfg *apiConfig) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range cfg.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func auditEventFromDB(event database.AuditEvent) AuditEvent {
+	return AuditEvent{
+		ID:        event.ID,
+		Action:    event.Action,
+		ActorID:   nullUUID(event.ActorID),
+		TargetID:  nullUUID(event.TargetID),
+		IP:        event.Ip,
+		UserAgent: event.UserAgent,
+		Metadata:  event.Metadata,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+func parseNullUUID(s string) (uuid.NullUUID, error) {
+	if s == "" {
+		return uuid.NullUUID{}, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+func parseNullTime(s string) (sql.NullTime, error) {
+	if s == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
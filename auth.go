@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/chaeanthony/chirpy/internal/auth"
 	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/mailer"
 	"github.com/google/uuid"
 )
 
@@ -19,6 +22,7 @@ type User struct {
 	UpdatedAt 	time.Time `json:"updated_at"`
 	Email     	string    `json:"email"`
 	IsChirpyRed bool 			`json:"is_chirpy_red"`
+	Role        string    `json:"role"`
 }
 
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -36,9 +40,15 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := cfg.passwordPolicy.Check(params.Password, params.Email); err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	pw, err := auth.HashPassword(params.Password)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to hash password: %v", err))
+		return
 	}
 
 	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: pw})
@@ -54,6 +64,7 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 			UpdatedAt: 	user.UpdatedAt,
 			Email:     	user.Email,
 			IsChirpyRed: user.IsChirpyRed,
+			Role: user.Role,
 		},
 	})
 }
@@ -64,66 +75,55 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	params := parameters{}
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
 		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to decode request. expected email, got: %v", err))
 		return
 	}
 
+	attempt, retryAt, err := cfg.reserveLoginAttempt(r, params.Email)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to check login attempts: %v", err))
+		return
+	}
+	if !retryAt.IsZero() {
+		setRetryAfter(w, retryAt)
+		WriteError(w, http.StatusTooManyRequests, errors.New("too many failed login attempts, try again later"))
+		return
+	}
+
+	// unknown emails get the same response, after the same amount of work, as wrong passwords
 	usr, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
 	if errors.Is(err, sql.ErrNoRows) {
-		WriteError(w, http.StatusNotFound, errors.New("failed to find user"))
+		auth.CheckDummyPassword(params.Password)
+		cfg.recordLoginFailure(r, attempt, nil)
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, uuid.Nil, map[string]any{"email_hash": cfg.auditEmailHash(params.Email), "reason": "unknown email"})
+		WriteError(w, http.StatusUnauthorized, errors.New("incorrect email or password"))
 		return
 	} else if err != nil {
+		cfg.releaseLoginAttempt(r.Context(), attempt)
 		WriteError(w, http.StatusInternalServerError, errors.New("failed to get user"))
 		return
 	}
 
 	if err := auth.CheckPasswordHash(params.Password, usr.HashedPassword); err != nil {
+		cfg.recordLoginFailure(r, attempt, &usr)
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": "wrong password"})
 		WriteError(w, http.StatusUnauthorized, errors.New("incorrect email or password"))
 		return
 	}
-
-	jwt, err := auth.MakeJWT(usr.ID, cfg.jwtSecret, time.Hour)
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create token: %v", err))
-		return
-	}
-
-	refresh_token, err := auth.MakeRefreshToken()
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create refresh token: %v", err))
+	cfg.clearLoginThrottle(r.Context(), attempt)
+	cfg.rehashPassword(r.Context(), usr, params.Password)
+	if err := checkAccountUsable(usr); err != nil {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": accountState(usr)})
+		WriteError(w, http.StatusForbidden, err)
 		return
 	}
-
-	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refresh_token,
-		UserID:    usr.ID,
-		ExpiresAt: sql.NullTime{Valid: true, Time: time.Now().AddDate(0, 0, 60)},
-	})
-	if err != nil {
-		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to store refresh token: %v", err))
+	if cfg.requirePasskey(w, r, usr) {
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, response{
-		User: User{
-			ID:        		usr.ID,
-			CreatedAt: 		usr.CreatedAt,
-			UpdatedAt: 		usr.UpdatedAt,
-			Email:     		usr.Email,
-			IsChirpyRed: 	usr.IsChirpyRed,
-		},
-		Token:        	jwt,
-		RefreshToken: 	refresh_token,
-	},
-	)
+	cfg.issueSession(w, r, usr, nil)
 }
 
 func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -145,8 +145,23 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 		WriteError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized. expired token"))
 		return
 	}
+	// tokens issued to OAuth clients are refreshed through /oauth/token
+	if dbToken.GrantID.Valid {
+		WriteError(w, http.StatusUnauthorized, errors.New("unauthorized. refresh OAuth tokens with POST /oauth/token"))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), dbToken.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if err := checkAccountUsable(usr); err != nil {
+		WriteError(w, http.StatusForbidden, err)
+		return
+	}
 
-	jwt, err := auth.MakeJWT(dbToken.UserID, cfg.jwtSecret, time.Hour)
+	jwt, err := auth.MakeJWT(usr.ID, auth.Role(usr.Role), cfg.jwtSecret, time.Hour)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create token: %v", err))
 		return
@@ -162,7 +177,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return 
 	}
 
-	_, err = cfg.db.UpdateToken(r.Context(), 
+	revoked, err := cfg.db.UpdateToken(r.Context(), 
 	database.UpdateTokenParams{
 		RevokedAt: sql.NullTime{Valid: true, Time: time.Now()}, 
 		UpdatedAt: time.Now(), 
@@ -173,59 +188,251 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return 
 	}
 
+	cfg.recordAudit(r, auditTokenRevoked, revoked.UserID, revoked.UserID, nil)
+
 	WriteJSON(w, http.StatusNoContent, nil)
 }
 
-func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+// passwordResetWindow is how long after logging in with an email link or a
+// passkey a user may choose a new password without giving the old one.
+const passwordResetWindow = 15 * time.Minute
+
+// handlerChangePassword sets a new password. The current password must be
+// given, except by users who have never had one or who have just logged in
+// with an email link or a passkey, which is how a forgotten password is reset. Every session, personal
+// access token and OAuth grant is revoked and the caller gets new tokens, so
+// a stolen session does not outlive the change.
+func (cfg *apiConfig) handlerChangePassword(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	type response struct {
-		User
-		Token string `json:"token"`
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
 	}
 
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
-		return 
+		return
 	}
-	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	claims, err := auth.ParseJWT(token, cfg.jwtSecret)
 	if err != nil {
 		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
-		return 
+		return
+	}
+	userId, err := claims.UserID()
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
 	}
 
-	// decode params to get new email/password from request
 	params := parameters{}
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to decode request. expected email, got: %v", err))
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected current_password and new_password, got: %v", err))
 		return
 	}
 
-	pw, err := auth.HashPassword(params.Password)
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("failed to find user"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	// accounts created through an external provider have a random password nobody knows
+	if usr.HasPassword && !recentPasswordlessLogin(claims) && !cfg.confirmPassword(w, r, usr, params.CurrentPassword) {
+		return
+	}
+	if usr.PasswordResetRequired && params.NewPassword == params.CurrentPassword {
+		WriteError(w, http.StatusBadRequest, errors.New("password reset required. choose a different password"))
+		return
+	}
+	if err := cfg.passwordPolicy.Check(params.NewPassword, usr.Email); err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	pw, err := auth.HashPassword(params.NewPassword)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to hash password: %v", err))
 		return
 	}
 
-	updated_user, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{ID: userId, Email: params.Email, HashedPassword: pw})
-	if errors.Is(err, sql.ErrNoRows) {
-		WriteError(w, http.StatusNotFound, errors.New("failed to find user"))
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
 		return
-	} else if err != nil {
-		WriteError(w, http.StatusInternalServerError, errors.New("failed to update user"))
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	updated, err := qtx.UpdatePassword(r.Context(), database.UpdatePasswordParams{ID: userId, HashedPassword: pw})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update password: %v", err))
+		return
+	}
+	// every way in that does not need the password goes: refresh tokens,
+	// access tokens, personal access tokens and OAuth grants
+	if err := qtx.RevokeUserTokens(r.Context(), userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to revoke sessions: %v", err))
+		return
+	}
+	if err := qtx.RevokeAccessTokens(r.Context(), userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to revoke access tokens: %v", err))
+		return
+	}
+	if err := qtx.DeletePersonalAccessTokensByUser(r.Context(), userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete personal access tokens: %v", err))
+		return
+	}
+	if err := qtx.RevokeUserOAuthGrants(r.Context(), userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to revoke OAuth grants: %v", err))
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditPasswordChanged, userId, userId, map[string]any{"had_password": usr.HasPassword, "reset": recentPasswordlessLogin(claims)})
+
+	err = cfg.mailer.Send(r.Context(), mailer.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy password was changed",
+		Text: "The password of your Chirpy account was changed. All of its sessions were logged out and its personal access tokens and OAuth app access were revoked.\n\n" +
+			"If you did not do this, ask for an email login link and use it to log in. For 15 minutes after logging in that way "+
+			"you can choose a new password without giving the old one.\n",
+	})
+	if err != nil {
+		log.Printf("failed to email user %s about password change: %v", userId, err)
+	}
+
+	cfg.issueSession(w, r, updated, map[string]any{"method": "password_change"})
+}
+
+// getViewerID returns the id of the user making the request, or uuid.Nil for
+// anonymous requests. A token that is present but invalid is an error.
+func (cfg *apiConfig) getViewerID(r *http.Request) (uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return auth.ValidateJWT(token, cfg.jwtSecret)
+}
 
-	WriteJSON(w, http.StatusOK, response{
+// rehashPassword replaces a hash made with bcrypt or outdated parameters
+// once the password is known to be correct. Failures only mean the old hash
+// is kept until the next login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, usr database.User, password string) {
+	if !auth.NeedsRehash(usr.HashedPassword) {
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("failed to rehash password of user %s: %v", usr.ID, err)
+		return
+	}
+	if err := cfg.db.UpdatePasswordHash(ctx, database.UpdatePasswordHashParams{ID: usr.ID, HashedPassword: hash}); err != nil {
+		log.Printf("failed to store rehashed password of user %s: %v", usr.ID, err)
+	}
+}
+
+// recentPasswordlessLogin reports whether the token comes from a login with
+// an email link or a passkey in the last passwordResetWindow. Both prove who
+// the user is without their password.
+func recentPasswordlessLogin(claims *auth.Claims) bool {
+	if claims.IssuedAt == nil || time.Since(claims.IssuedAt.Time) > passwordResetWindow {
+		return false
+	}
+	return claims.LoggedInWith("magic_link") || claims.LoggedInWith("passkey")
+}
+
+// confirmPassword checks the password of a signed in user before a sensitive
+// change. Wrong passwords count towards the login lockout. It writes the
+// response and returns false when the password is not confirmed.
+func (cfg *apiConfig) confirmPassword(w http.ResponseWriter, r *http.Request, usr database.User, password string) bool {
+	attempt, retryAt, err := cfg.reserveLoginAttempt(r, usr.Email)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to check login attempts: %v", err))
+		return false
+	}
+	if !retryAt.IsZero() {
+		setRetryAfter(w, retryAt)
+		WriteError(w, http.StatusTooManyRequests, errors.New("too many failed password attempts, try again later"))
+		return false
+	}
+	if err := auth.CheckPasswordHash(password, usr.HashedPassword); err != nil {
+		cfg.recordLoginFailure(r, attempt, &usr)
+		WriteError(w, http.StatusUnauthorized, errors.New("incorrect password"))
+		return false
+	}
+	cfg.clearLoginThrottle(r.Context(), attempt)
+	return true
+}
+
+// LoginResponse is the response to a successful login.
+type LoginResponse struct {
+	User
+	Token                 string `json:"token"`
+	RefreshToken          string `json:"refresh_token"`
+	PasswordResetRequired bool   `json:"password_reset_required,omitempty"`
+}
+
+// issueSession logs in a user who has proven who they are: it creates their
+// access and refresh tokens, records the login and responds with them.
+// metadata tells the audit log how the user logged in.
+func (cfg *apiConfig) issueSession(w http.ResponseWriter, r *http.Request, usr database.User, metadata map[string]any) {
+	resp, err := cfg.createSession(r, usr, metadata)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// createSession does the work of issueSession for handlers that respond
+// with the tokens some other way.
+func (cfg *apiConfig) createSession(r *http.Request, usr database.User, metadata map[string]any) (LoginResponse, error) {
+	methods := []string{}
+	if method, ok := metadata["method"].(string); ok {
+		methods = append(methods, method)
+	}
+	token, err := auth.MakeLoginJWT(usr.ID, auth.Role(usr.Role), methods, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("failed to create token: %v", err)
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("failed to create refresh token: %v", err)
+	}
+
+	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    usr.ID,
+		ExpiresAt: sql.NullTime{Valid: true, Time: time.Now().AddDate(0, 0, 60)},
+	})
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("failed to store refresh token: %v", err)
+	}
+
+	cfg.recordAudit(r, auditLogin, usr.ID, usr.ID, metadata)
+
+	return LoginResponse{
 		User: User{
-			ID: updated_user.ID,
-			CreatedAt: updated_user.CreatedAt,
-			UpdatedAt: updated_user.UpdatedAt,
-			Email: updated_user.Email,
-			IsChirpyRed: updated_user.IsChirpyRed,
+			ID:          usr.ID,
+			CreatedAt:   usr.CreatedAt,
+			UpdatedAt:   usr.UpdatedAt,
+			Email:       usr.Email,
+			IsChirpyRed: usr.IsChirpyRed,
+			Role:        usr.Role,
 		},
-	})
-}
\ No newline at end of file
+		Token:                 token,
+		RefreshToken:          refreshToken,
+		PasswordResetRequired: usr.PasswordResetRequired,
+	}, nil
+}
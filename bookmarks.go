@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/filter"
+	"github.com/google/uuid"
+)
+
+type Bookmark struct {
+	Chirp      Chirp     `json:"chirp"`
+	Collection string    `json:"collection"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerCreateBookmark(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Collection string `json:"collection"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse chirp id: %v", err))
+		return
+	}
+
+	// the body is optional, bookmarks without a collection are unsorted
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+	collection := strings.TrimSpace(params.Collection)
+	const maxCollectionLength = 64
+	if filter.Length(collection) > maxCollectionLength {
+		WriteError(w, http.StatusBadRequest, errors.New("collection name is too long"))
+		return
+	}
+
+	chirp, err := cfg.getVisibleChirp(r.Context(), chirpId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("chirp not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get chirp: %v", err))
+		return
+	}
+
+	bookmark, err := cfg.db.CreateBookmark(r.Context(), database.CreateBookmarkParams{
+		UserID:     userId,
+		ChirpID:    chirp.ID,
+		Collection: collection,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create bookmark: %v", err))
+		return
+	}
+
+	resp := []Chirp{chirpFromDB(chirp)}
+	resp[0].BookmarkedByMe = true
+	if err := cfg.prepareChirps(r.Context(), resp, userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to prepare chirp: %v", err))
+		return
+	}
+	WriteJSON(w, http.StatusCreated, Bookmark{
+		Chirp:      resp[0],
+		Collection: bookmark.Collection,
+		CreatedAt:  bookmark.CreatedAt,
+	})
+}
+
+func (cfg *apiConfig) handlerDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse chirp id: %v", err))
+		return
+	}
+
+	n, err := cfg.db.DeleteBookmark(r.Context(), database.DeleteBookmarkParams{UserID: userId, ChirpID: chirpId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete bookmark: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("bookmark not found"))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerGetBookmarks(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the query leaves out chirps that stopped being visible after they were
+	// bookmarked, e.g. after an unfollow, so pages stay full
+	rows, err := cfg.db.GetBookmarks(r.Context(), database.GetBookmarksParams{
+		UserID:     userId,
+		Collection: strings.TrimSpace(r.URL.Query().Get("collection")),
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve bookmarks: %v", err))
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(rows))
+	bookmarks := []Bookmark{}
+	for _, row := range rows {
+		chirp := Chirp{
+			ID:             row.ID,
+			CreatedAt:      row.CreatedAt,
+			UpdatedAt:      row.UpdatedAt,
+			Body:           row.Body,
+			UserID:         row.UserID,
+			Visibility:     row.Visibility,
+			SpoilerText:    row.SpoilerText,
+			Sensitive:      row.Sensitive,
+			Held:           row.Held,
+			BookmarkedByMe: true,
+		}
+		chirps = append(chirps, chirp)
+		bookmarks = append(bookmarks, Bookmark{
+			Collection: row.Collection,
+			CreatedAt:  row.BookmarkedAt,
+		})
+	}
+	if err := cfg.prepareChirps(r.Context(), chirps, userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't prepare chirps: %v", err))
+		return
+	}
+	for i := range bookmarks {
+		bookmarks[i].Chirp = chirps[i]
+	}
+
+	WriteJSON(w, http.StatusOK, bookmarks)
+}
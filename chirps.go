@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"sort"
 	"strings"
@@ -12,21 +14,39 @@ import (
 
 	"github.com/chaeanthony/chirpy/internal/auth"
 	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/filter"
+	"github.com/chaeanthony/chirpy/internal/spam"
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time	`json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string		`json:"body"`
-	UserID    uuid.UUID	`json:"user_id"`
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Body           string    `json:"body"`
+	UserID         uuid.UUID `json:"user_id"`
+	Visibility     string    `json:"visibility"`
+	SpoilerText    string    `json:"spoiler_text"`
+	Sensitive      bool      `json:"sensitive"`
+	Collapsed      bool      `json:"collapsed"`
+	BookmarkedByMe bool      `json:"bookmarked_by_me"`
+	Poll           *Poll     `json:"poll,omitempty"`
+	Pinned         bool      `json:"pinned,omitempty"`
+	// Held chirps are waiting for spam review and only shown to their author
+	Held           bool      `json:"held,omitempty"`
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Body 		string 		`json:"body"`
 		// UserID 	uuid.UUID `json:"user_id"`
+		Poll 		*pollParameters `json:"poll"`
+		// Visibility is public (default), followers or mentioned
+		Visibility 	string 		`json:"visibility"`
+		Mentions 	[]uuid.UUID `json:"mentions"`
+		// SpoilerText is an optional content warning shown instead of the body
+		SpoilerText string 		`json:"spoiler_text"`
+		Sensitive 	bool 			`json:"sensitive"`
 	}
 
 	type response struct {
@@ -44,42 +64,184 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return 
 	}
 
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if usr.PostingCooldownUntil.Valid && time.Now().Before(usr.PostingCooldownUntil.Time) {
+		setRetryAfter(w, usr.PostingCooldownUntil.Time)
+		WriteError(w, http.StatusTooManyRequests, errors.New("posting is paused for this account, try again later"))
+		return
+	}
+
 	params := parameters{}
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
 		WriteError(w, http.StatusInternalServerError, errors.New("failed to decode request"))
 		return
 	}
 
-	cleaned, err := validateChirp(params.Body)
+	cleaned, err := cfg.validateChirp(params.Body)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	const maxSpoilerTextLength = 100
+	spoilerText := cfg.chirpFilter.Load().Apply(strings.TrimSpace(params.SpoilerText))
+	if filter.Length(spoilerText.Text) > maxSpoilerTextLength {
+		WriteError(w, http.StatusBadRequest, errors.New("spoiler text is too long"))
+		return
+	}
+	if spoilerText.Rejected {
+		WriteError(w, http.StatusBadRequest, errors.New("spoiler text contains prohibited language"))
+		return
+	}
+
+	visibility, err := validateVisibility(params.Visibility)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	mentions, err := cfg.validateMentions(r.Context(), params.Mentions)
 	if err != nil {
 		WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if visibility == visibilityMentioned && len(mentions) == 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("mentioned-only chirps must mention at least one user"))
+		return
+	}
+
+	var pollOptions []string
+	var pollExpiresAt time.Time
+	var pollFiltered filter.Result
+	if params.Poll != nil {
+		pollOptions, pollExpiresAt, pollFiltered, err = validatePoll(*params.Poll, cfg.chirpFilter.Load())
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	spamResult := cfg.checkSpam(r.Context(), usr, cleaned.Text)
+	switch spamResult.Verdict {
+	case spam.VerdictReject:
+		if err := storeSpamScore(r.Context(), cfg.db, uuid.NullUUID{}, userId, cleaned.Text, spamResult); err != nil {
+			log.Printf("failed to store spam score: %v", err)
+		}
+		WriteError(w, http.StatusBadRequest, errors.New("chirp was rejected as spam"))
+		return
+	case spam.VerdictRateLimit:
+		if err := storeSpamScore(r.Context(), cfg.db, uuid.NullUUID{}, userId, cleaned.Text, spamResult); err != nil {
+			log.Printf("failed to store spam score: %v", err)
+		}
+		until := time.Now().Add(cfg.spamConfig.RateLimit())
+		if err := cfg.db.SetPostingCooldown(r.Context(), database.SetPostingCooldownParams{
+			ID:                   userId,
+			PostingCooldownUntil: sql.NullTime{Time: until, Valid: true},
+		}); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to pause posting: %v", err))
+			return
+		}
+		setRetryAfter(w, until)
+		WriteError(w, http.StatusTooManyRequests, errors.New("chirp looks like spam, posting is paused for this account"))
+		return
+	}
+	held := spamResult.Verdict == spam.VerdictHold
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{Body: cleaned, UserID: userId})
+	// the chirp, its mentions and its poll are created together or not at all
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:        cleaned.Text,
+		UserID:      userId,
+		Visibility:  visibility,
+		SpoilerText: spoilerText.Text,
+		Sensitive:   params.Sensitive,
+		Held:        held,
+	})
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create chirp. got: %v", err))
 		return 
 	}
+	if flagged := mergeFiltered(cleaned, spoilerText, pollFiltered); flagged.Flagged {
+		reason := filterReason(flagged)
+		_, err := qtx.CreateChirpFlag(r.Context(), database.CreateChirpFlagParams{
+			ChirpID: chirp.ID,
+			Source:  flagSourceFilter,
+			Reason:  reason,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to flag chirp: %v", err))
+			return
+		}
+	}
+	if held {
+		if err := storeSpamScore(r.Context(), qtx, uuid.NullUUID{UUID: chirp.ID, Valid: true}, userId, cleaned.Text, spamResult); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to store spam score: %v", err))
+			return
+		}
+	}
+	for _, mentionedID := range mentions {
+		if err := qtx.CreateChirpMention(r.Context(), database.CreateChirpMentionParams{ChirpID: chirp.ID, UserID: mentionedID}); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create mention: %v", err))
+			return
+		}
+	}
+	if params.Poll != nil {
+		if err := createPoll(r.Context(), qtx, chirp.ID, pollOptions, pollExpiresAt); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create poll: %v", err))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create chirp. got: %v", err))
+		return
+	}
+
+	resp := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.prepareChirps(r.Context(), resp, userId); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to prepare chirp: %v", err))
+		return
+	}
 
 	WriteJSON(w, http.StatusCreated, response{
-		Chirp: Chirp{
-			ID: chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body: chirp.Body,
-			UserID: chirp.UserID,
-		},
+		Chirp: resp[0],
 	})
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := cfg.db.GetChirps(r.Context())
+	viewerID, err := cfg.getViewerID(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbChirps, err := cfg.db.GetVisibleChirps(r.Context(), viewerID)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve chirps: %v", err))
 		return
 	}
 
+	bookmarked := map[uuid.UUID]bool{}
+	if viewerID != uuid.Nil {
+		ids, err := cfg.db.GetBookmarkedChirpIDs(r.Context(), viewerID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve bookmarks: %v", err))
+			return
+		}
+		for _, id := range ids {
+			bookmarked[id] = true
+		}
+	}
+
 	authorID := uuid.Nil
 	authorIDString := r.URL.Query().Get("author_id")
 	if authorIDString != "" {
@@ -97,13 +259,9 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		chirps = append(chirps, Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			UserID:    dbChirp.UserID,
-			Body:      dbChirp.Body,
-		})
+		chirp := chirpFromDB(dbChirp)
+		chirp.BookmarkedByMe = bookmarked[dbChirp.ID]
+		chirps = append(chirps, chirp)
 	}
 
 	sortDirection := "asc"
@@ -119,10 +277,43 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 		return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
 	})
 
+	// an author's pinned chirps are listed first, most recently pinned first
+	if authorID != uuid.Nil {
+		pinnedIDs, err := cfg.db.GetPinnedChirpIDs(r.Context(), authorID)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve pinned chirps: %v", err))
+			return
+		}
+		pinRank := map[uuid.UUID]int{}
+		for i, id := range pinnedIDs {
+			pinRank[id] = i
+		}
+		for i := range chirps {
+			_, chirps[i].Pinned = pinRank[chirps[i].ID]
+		}
+		sort.SliceStable(chirps, func(i, j int) bool {
+			if chirps[i].Pinned && chirps[j].Pinned {
+				return pinRank[chirps[i].ID] < pinRank[chirps[j].ID]
+			}
+			return chirps[i].Pinned && !chirps[j].Pinned
+		})
+	}
+
+	if err := cfg.prepareChirps(r.Context(), chirps, viewerID); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't prepare chirps: %v", err))
+		return
+	}
+
 	WriteJSON(w, http.StatusOK, chirps)
 }
 
 func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.getViewerID(r)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
 	str := r.PathValue("chirpId")
 	chirpId, err := uuid.Parse(str)
 	if err != nil {
@@ -130,19 +321,26 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
+	chirp, err := cfg.getVisibleChirp(r.Context(), chirpId, viewerID)
 	if err != nil {
 		WriteError(w, http.StatusNotFound, fmt.Errorf("failed to get chirp: %v", err))
 		return 
 	}
 
-	WriteJSON(w, http.StatusOK, Chirp{
-		ID: chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body: chirp.Body,
-		UserID: chirp.UserID,
-	})
+	resp := []Chirp{chirpFromDB(chirp)}
+	if viewerID != uuid.Nil {
+		resp[0].BookmarkedByMe, err = cfg.db.IsChirpBookmarked(r.Context(), database.IsChirpBookmarkedParams{UserID: viewerID, ChirpID: chirp.ID})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get bookmark: %v", err))
+			return
+		}
+	}
+	if err := cfg.prepareChirps(r.Context(), resp, viewerID); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to prepare chirp: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp[0])
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
@@ -164,10 +362,14 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
-	if err != nil {
-		WriteError(w, http.StatusNotFound, fmt.Errorf("failed to get chirp: %v", err))
-		return 
+	// chirps the user cannot see are not found, so their existence is not revealed
+	chirp, err := cfg.getVisibleChirp(r.Context(), chirpId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("chirp not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get chirp: %v", err))
+		return
 	}
 	if chirp.UserID != userId {
 		WriteError(w, http.StatusForbidden, fmt.Errorf("incorrect chirp author"))
@@ -186,29 +388,74 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 }
 
 // helpers ---------------------------------------------------------
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
-	if len(body) > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+func chirpFromDB(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:          chirp.ID,
+		CreatedAt:   chirp.CreatedAt,
+		UpdatedAt:   chirp.UpdatedAt,
+		Body:        chirp.Body,
+		UserID:      chirp.UserID,
+		Visibility:  chirp.Visibility,
+		SpoilerText: chirp.SpoilerText,
+		Sensitive:   chirp.Sensitive,
+		Held:        chirp.Held,
+	}
+}
+
+// prepareChirps fills in the viewer dependent parts of chirps: polls and
+// whether the chirp is shown collapsed.
+func (cfg *apiConfig) prepareChirps(ctx context.Context, chirps []Chirp, viewerID uuid.UUID) error {
+	if err := cfg.attachPolls(ctx, chirps, viewerID); err != nil {
+		return err
 	}
 
-	badWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	prefs, err := cfg.getPreferences(ctx, viewerID)
+	if err != nil {
+		return err
 	}
-	cleaned := getCleanedBody(body, badWords)
-	return cleaned, nil
+	for i := range chirps {
+		chirps[i].Collapsed = prefs.collapsed(chirps[i])
+	}
+	return nil
 }
 
-func getCleanedBody(body string, badWords map[string]struct{}) string {
-	words := strings.Split(body, " ")
-	for i, word := range words {
-		loweredWord := strings.ToLower(word)
-		if _, ok := badWords[loweredWord]; ok {
-			words[i] = "****"
+// validateMentions removes duplicate mentions and checks the mentioned users exist.
+func (cfg *apiConfig) validateMentions(ctx context.Context, mentions []uuid.UUID) ([]uuid.UUID, error) {
+	const maxMentions = 10
+
+	unique := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range mentions {
+		if seen[id] {
+			continue
 		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	if len(unique) > maxMentions {
+		return nil, fmt.Errorf("cannot mention more than %d users", maxMentions)
+	}
+
+	for _, id := range unique {
+		if _, err := cfg.db.GetUserByID(ctx, id); errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("mentioned user %s not found", id)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get mentioned user: %v", err)
+		}
+	}
+	return unique, nil
+}
+
+// validateChirp checks the chirp length and runs the body through the word filter.
+func (cfg *apiConfig) validateChirp(body string) (filter.Result, error) {
+	const maxChirpLength = 140
+	if filter.Length(body) > maxChirpLength {
+		return filter.Result{}, errors.New("Chirp is too long")
+	}
+
+	result := cfg.chirpFilter.Load().Apply(body)
+	if result.Rejected {
+		return filter.Result{}, errors.New("Chirp contains prohibited language")
 	}
-	cleaned := strings.Join(words, " ")
-	return cleaned
+	return result, nil
 }
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+//go:embed templates/admin/*.html
+var adminTemplateFS embed.FS
+
+var adminTemplates = template.Must(template.ParseFS(adminTemplateFS, "templates/admin/*.html"))
+
+const (
+	adminCookieName = "chirpy_admin_token"
+	adminSessionTTL = time.Hour
+)
+
+type adminPage struct {
+	Title string
+	// Admin is the email of the logged in admin
+	Admin string
+}
+
+func (cfg *apiConfig) handlerDashboard(w http.ResponseWriter, r *http.Request) {
+	const pageSize = 50
+
+	type page struct {
+		adminPage
+		Hits        int32
+		UserCount   int64
+		OpenReports int64
+		Query       string
+		Users       []AdminUser
+		NextOffset  int32
+	}
+
+	_, offset, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := page{
+		adminPage: cfg.newAdminPage(r, "Dashboard"),
+		Hits:      cfg.fileserverHits.Load(),
+		Query:     r.URL.Query().Get("email"),
+	}
+	if data.UserCount, err = cfg.db.CountUsers(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("failed to count users: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if data.OpenReports, err = cfg.db.CountReportsByStatus(r.Context(), reportStatusOpen); err != nil {
+		http.Error(w, fmt.Sprintf("failed to count reports: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if data.Users, err = cfg.searchUsers(r.Context(), data.Query, pageSize, offset); err != nil {
+		http.Error(w, fmt.Sprintf("failed to search users: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(data.Users) == pageSize {
+		data.NextOffset = offset + pageSize
+	}
+
+	renderAdminPage(w, http.StatusOK, "dashboard.html", data)
+}
+
+func (cfg *apiConfig) handlerDashboardUser(w http.ResponseWriter, r *http.Request) {
+	type page struct {
+		adminPage
+		User AdminUserDetail
+	}
+
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	detail, err := cfg.getAdminUserDetail(r.Context(), usr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get user details: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	renderAdminPage(w, http.StatusOK, "user.html", page{
+		adminPage: cfg.newAdminPage(r, usr.Email),
+		User:      detail,
+	})
+}
+
+// handlerDashboardUserAction handles the action forms on the user page and
+// redirects back to it.
+func (cfg *apiConfig) handlerDashboardUserAction(w http.ResponseWriter, r *http.Request) {
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch r.PathValue("action") {
+	case "revoke-sessions":
+		err = cfg.revokeSessions(r, usr)
+	case "password-reset":
+		err = cfg.forcePasswordReset(r, usr)
+	case "chirpy-red":
+		_, err = cfg.setChirpyRed(r, usr, r.FormValue("is_chirpy_red") == "true")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to update user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/dashboard/users/"+usr.ID.String(), http.StatusSeeOther)
+}
+
+func (cfg *apiConfig) handlerDashboardLoginPage(w http.ResponseWriter, r *http.Request) {
+	renderAdminPage(w, http.StatusOK, "login.html", struct {
+		adminPage
+		Error string
+	}{adminPage: adminPage{Title: "Log in"}})
+}
+
+func (cfg *apiConfig) handlerDashboardLogin(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, message string) {
+		renderAdminPage(w, status, "login.html", struct {
+			adminPage
+			Error string
+		}{adminPage: adminPage{Title: "Log in"}, Error: message})
+	}
+
+	if !sameOrigin(r) {
+		fail(http.StatusForbidden, "Cross-origin request refused.")
+		return
+	}
+
+	email := r.FormValue("email")
+	attempt, retryAt, err := cfg.reserveLoginAttempt(r, email)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to check login attempts.")
+		return
+	}
+	if !retryAt.IsZero() {
+		setRetryAfter(w, retryAt)
+		fail(http.StatusTooManyRequests, "Too many failed login attempts, try again later.")
+		return
+	}
+
+	usr, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		auth.CheckDummyPassword(r.FormValue("password"))
+		cfg.recordLoginFailure(r, attempt, nil)
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, uuid.Nil, map[string]any{"email_hash": cfg.auditEmailHash(email), "reason": "wrong email or password", "source": "dashboard"})
+		fail(http.StatusUnauthorized, "Incorrect email or password.")
+		return
+	}
+	if auth.CheckPasswordHash(r.FormValue("password"), usr.HashedPassword) != nil {
+		cfg.recordLoginFailure(r, attempt, &usr)
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": "wrong email or password", "source": "dashboard"})
+		fail(http.StatusUnauthorized, "Incorrect email or password.")
+		return
+	}
+	cfg.clearLoginThrottle(r.Context(), attempt)
+	cfg.rehashPassword(r.Context(), usr, r.FormValue("password"))
+	if err := checkAccountUsable(usr); err != nil || !auth.Role(usr.Role).Allows(auth.RoleAdmin) {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": "not an active admin", "source": "dashboard"})
+		fail(http.StatusForbidden, "Admin access required.")
+		return
+	}
+	// the form cannot ask for a passkey, so it must not let these accounts skip theirs
+	if usr.PasskeyRequired {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": "passkey required", "source": "dashboard"})
+		fail(http.StatusForbidden, "This account requires a passkey, which the dashboard login does not support.")
+		return
+	}
+	if usr.PasswordResetRequired {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"reason": "password reset required", "source": "dashboard"})
+		fail(http.StatusForbidden, "This account must choose a new password before it can use the dashboard.")
+		return
+	}
+
+	token, err := auth.MakeJWT(usr.ID, auth.Role(usr.Role), cfg.jwtSecret, adminSessionTTL)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to create session.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookieName,
+		Value:    token,
+		Path:     "/admin",
+		MaxAge:   int(adminSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		// Strict keeps other sites from making the browser send the cookie along with forged form posts
+		SameSite: http.SameSiteStrictMode,
+	})
+	cfg.recordAudit(r, auditLogin, usr.ID, usr.ID, map[string]any{"source": "dashboard"})
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+func (cfg *apiConfig) handlerDashboardLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookieName,
+		Value:    "",
+		Path:     "/admin",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/admin/dashboard/login", http.StatusSeeOther)
+}
+
+// middlewareAdminPage sends visitors without a valid admin session to the
+// login page instead of answering with a JSON error.
+func (cfg *apiConfig) middlewareAdminPage(next http.HandlerFunc) http.Handler {
+	requireAdmin := cfg.middlewareRequireRole(auth.RoleAdmin, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(adminCookieName)
+		if err != nil {
+			http.Redirect(w, r, "/admin/dashboard/login", http.StatusSeeOther)
+			return
+		}
+		if _, err := auth.ParseJWT(cookie.Value, cfg.jwtSecret); err != nil {
+			http.Redirect(w, r, "/admin/dashboard/login", http.StatusSeeOther)
+			return
+		}
+		requireAdmin.ServeHTTP(w, r)
+	})
+}
+
+// helpers ---------------------------------------------------------
+func (cfg *apiConfig) newAdminPage(r *http.Request, title string) adminPage {
+	page := adminPage{Title: title}
+	if usr, err := cfg.db.GetUserByID(r.Context(), userIDFromContext(r.Context())); err == nil {
+		page.Admin = usr.Email
+	}
+	return page
+}
+
+func renderAdminPage(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := adminTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("failed to render %s: %v", name, err)
+	}
+}
+
+// sameOrigin reports whether a browser request was sent by a page of this
+// site. Requests without an Origin header come from non-browser clients.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
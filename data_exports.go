@@ -0,0 +1,497 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	// dataExportTTL is how long a finished archive is kept for download.
+	dataExportTTL = 7 * 24 * time.Hour
+	// dataExportLinkTTL is how long a signed download link works.
+	dataExportLinkTTL = 24 * time.Hour
+	// dataExportTimeout is how long building an archive may take before
+	// another worker starts it again.
+	dataExportTimeout = 30 * time.Minute
+	// dataExportDownloadTimeout replaces the server's write timeout for
+	// downloads, which are larger and slower than other responses.
+	dataExportDownloadTimeout = time.Hour
+)
+
+const (
+	dataExportPending = "pending"
+	dataExportRunning = "running"
+	dataExportReady   = "ready"
+	dataExportFailed  = "failed"
+)
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	// DownloadURL is only set for ready exports. It works without a token
+	// until its expiry, so it can be opened in a browser.
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// handlerCreateDataExport asks for an archive of the user's data. It is
+// built in the background; the user is notified when it is ready.
+func (cfg *apiConfig) handlerCreateDataExport(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	// archives are expensive to build, one a day is plenty
+	count, err := cfg.db.CountRecentDataExports(r.Context(), database.CountRecentDataExportsParams{UserID: userId, CreatedAt: time.Now().Add(-24 * time.Hour)})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to count exports: %v", err))
+		return
+	}
+	if count > 0 {
+		WriteError(w, http.StatusTooManyRequests, errors.New("you can request one export a day"))
+		return
+	}
+
+	export, err := cfg.db.CreateDataExport(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create export: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditDataExportRequested, userId, userId, map[string]any{"export_id": export.ID})
+
+	WriteJSON(w, http.StatusAccepted, cfg.dataExportFromDB(export))
+}
+
+func (cfg *apiConfig) handlerGetDataExports(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbExports, err := cfg.db.GetDataExportsByUser(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve exports: %v", err))
+		return
+	}
+
+	exports := []DataExport{}
+	for _, export := range dbExports {
+		exports = append(exports, cfg.dataExportFromDB(export))
+	}
+
+	WriteJSON(w, http.StatusOK, exports)
+}
+
+// handlerDownloadDataExport serves an archive to anyone with a valid signed
+// link.
+func (cfg *apiConfig) handlerDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	exportId, err := uuid.Parse(r.PathValue("exportId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid export id: %v", err))
+		return
+	}
+	expires := r.URL.Query().Get("expires")
+	signature, err := hex.DecodeString(r.URL.Query().Get("signature"))
+	if err != nil || !hmac.Equal(signature, cfg.signDataExport(exportId, expires)) {
+		WriteError(w, http.StatusForbidden, errors.New("invalid download link"))
+		return
+	}
+	expiresUnix, _ := strconv.ParseInt(expires, 10, 64)
+	if time.Now().After(time.Unix(expiresUnix, 0)) {
+		WriteError(w, http.StatusForbidden, errors.New("download link has expired, get a new one from your exports"))
+		return
+	}
+
+	export, err := cfg.db.GetDataExport(r.Context(), exportId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (export.Status != dataExportReady || time.Now().After(export.ExpiresAt.Time))) {
+		WriteError(w, http.StatusNotFound, errors.New("export not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get export: %v", err))
+		return
+	}
+
+	f, err := os.Open(export.FilePath)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to open export: %v", err))
+		return
+	}
+	defer f.Close()
+
+	name := fmt.Sprintf("chirpy-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(dataExportDownloadTimeout)); err != nil {
+		log.Printf("failed to extend write deadline of export %s: %v", export.ID, err)
+	}
+	http.ServeContent(w, r, name, export.CompletedAt.Time, f)
+}
+
+// runDataExports builds requested archives and deletes expired ones every
+// interval until stop is done. Several servers can run it at once, each
+// export is claimed by one of them. An export being built when stop ends is
+// finished under ctx, which shutdown cancels once its deadline passes.
+func (cfg *apiConfig) runDataExports(stop, ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cfg.processDataExports(stop, ctx)
+		select {
+		case <-stop.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// helpers ---------------------------------------------------------
+
+func (cfg *apiConfig) processDataExports(stop, ctx context.Context) {
+	// exports left running by a server that stopped are started again
+	err := cfg.db.RequeueStaleDataExports(ctx, sql.NullTime{Time: time.Now().Add(-dataExportTimeout), Valid: true})
+	if err != nil {
+		log.Printf("failed to requeue stale exports: %v", err)
+	}
+
+	expired, err := cfg.db.GetExpiredDataExports(ctx)
+	if err != nil {
+		log.Printf("failed to get expired exports: %v", err)
+	}
+	for _, export := range expired {
+		if err := os.Remove(export.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("failed to delete export %s: %v", export.ID, err)
+			continue
+		}
+		if err := cfg.db.DeleteDataExport(ctx, export.ID); err != nil {
+			log.Printf("failed to delete export %s: %v", export.ID, err)
+		}
+	}
+
+	for stop.Err() == nil {
+		export, err := cfg.db.ClaimDataExport(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		} else if err != nil {
+			log.Printf("failed to claim export: %v", err)
+			return
+		}
+		if err := cfg.buildDataExport(ctx, export); err != nil {
+			log.Printf("failed to build export %s: %v", export.ID, err)
+			if ctx.Err() != nil {
+				// cut off by shutdown, so another server can start it again
+				requeueCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+				defer cancel()
+				if err := cfg.db.RequeueDataExport(requeueCtx, export.ID); err != nil {
+					log.Printf("failed to requeue export %s: %v", export.ID, err)
+				}
+				return
+			}
+			if err := cfg.db.FailDataExport(ctx, export.ID); err != nil {
+				log.Printf("failed to mark export %s failed: %v", export.ID, err)
+			}
+		}
+	}
+}
+
+// buildDataExport writes the archive of an export and tells the user it is
+// ready. The file is written under a temporary name so a half written
+// archive is never served.
+func (cfg *apiConfig) buildDataExport(ctx context.Context, export database.DataExport) error {
+	ctx, cancel := context.WithTimeout(ctx, dataExportTimeout)
+	defer cancel()
+
+	usr, err := cfg.db.GetUserByID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cfg.exportDir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(cfg.exportDir, export.ID.String()+".zip")
+	f, err := os.CreateTemp(cfg.exportDir, "export-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := cfg.writeDataExport(ctx, f, usr); err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(dataExportTTL)
+	err = cfg.db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        export.ID,
+		FilePath:  path,
+		SizeBytes: info.Size(),
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	message := fmt.Sprintf("Your data export is ready. You can download it from your exports until %s.", expiresAt.UTC().Format(time.RFC1123))
+	if err := notify(ctx, cfg.db, usr.ID, notificationDataExport, message); err != nil {
+		log.Printf("failed to notify user %s of export: %v", usr.ID, err)
+	}
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy data export is ready",
+		Text: fmt.Sprintf("The archive of your Chirpy data you asked for is ready:\n\n%s\n\nThe link works for %d hours. "+
+			"After that you can get a new link from your exports until %s.\n",
+			cfg.dataExportURL(export.ID, time.Now().Add(dataExportLinkTTL)), int(dataExportLinkTTL.Hours()), expiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Printf("failed to email user %s about export: %v", usr.ID, err)
+	}
+	return nil
+}
+
+// writeDataExport writes a zip archive with a JSON file for each kind of data
+// kept about usr. Chirps have no media, so the archive holds JSON only.
+func (cfg *apiConfig) writeDataExport(ctx context.Context, f *os.File, usr database.User) error {
+	type exportChirp struct {
+		ID          uuid.UUID `json:"id"`
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+		Body        string    `json:"body"`
+		Visibility  string    `json:"visibility"`
+		SpoilerText string    `json:"spoiler_text"`
+		Sensitive   bool      `json:"sensitive"`
+	}
+	type exportBookmark struct {
+		ChirpID    uuid.UUID `json:"chirp_id"`
+		Collection string    `json:"collection"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	type exportPollVote struct {
+		PollID    uuid.UUID `json:"poll_id"`
+		OptionID  uuid.UUID `json:"option_id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type exportFollow struct {
+		FollowerID uuid.UUID `json:"follower_id"`
+		FolloweeID uuid.UUID `json:"followee_id"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	type exportSession struct {
+		CreatedAt time.Time  `json:"created_at"`
+		LastUsed  time.Time  `json:"last_used_at"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		RevokedAt *time.Time `json:"revoked_at"`
+		// OAuthGrantID is set for sessions of third-party apps
+		OAuthGrantID *uuid.UUID `json:"oauth_grant_id"`
+	}
+
+	files := map[string]any{}
+	files["profile.json"] = struct {
+		User
+		AccountState    string `json:"account_state"`
+		HasPassword     bool   `json:"has_password"`
+		PasskeyRequired bool   `json:"passkey_required"`
+	}{
+		User: User{
+			ID:          usr.ID,
+			CreatedAt:   usr.CreatedAt,
+			UpdatedAt:   usr.UpdatedAt,
+			Email:       usr.Email,
+			IsChirpyRed: usr.IsChirpyRed,
+			Role:        usr.Role,
+		},
+		AccountState:    accountState(usr),
+		HasPassword:     usr.HasPassword,
+		PasskeyRequired: usr.PasskeyRequired,
+	}
+
+	chirps, err := cfg.db.GetExportChirps(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportChirps := []exportChirp{}
+	for _, c := range chirps {
+		exportChirps = append(exportChirps, exportChirp(c))
+	}
+	files["chirps.json"] = exportChirps
+
+	bookmarks, err := cfg.db.GetExportBookmarks(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportBookmarks := []exportBookmark{}
+	for _, b := range bookmarks {
+		exportBookmarks = append(exportBookmarks, exportBookmark(b))
+	}
+	files["bookmarks.json"] = exportBookmarks
+
+	votes, err := cfg.db.GetExportPollVotes(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportVotes := []exportPollVote{}
+	for _, v := range votes {
+		exportVotes = append(exportVotes, exportPollVote(v))
+	}
+	files["poll_votes.json"] = exportVotes
+
+	follows, err := cfg.db.GetExportFollows(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportFollows := []exportFollow{}
+	for _, f := range follows {
+		exportFollows = append(exportFollows, exportFollow(f))
+	}
+	files["follows.json"] = exportFollows
+
+	sessions, err := cfg.db.GetExportSessions(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportSessions := []exportSession{}
+	for _, s := range sessions {
+		session := exportSession{CreatedAt: s.CreatedAt, LastUsed: s.UpdatedAt, OAuthGrantID: nullUUID(s.GrantID)}
+		if s.ExpiresAt.Valid {
+			session.ExpiresAt = &s.ExpiresAt.Time
+		}
+		if s.RevokedAt.Valid {
+			session.RevokedAt = &s.RevokedAt.Time
+		}
+		exportSessions = append(exportSessions, session)
+	}
+	files["sessions.json"] = exportSessions
+
+	identities, err := cfg.db.GetExternalIdentitiesByUser(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportIdentities := []ExternalIdentity{}
+	for _, identity := range identities {
+		exportIdentities = append(exportIdentities, ExternalIdentity{
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+	files["identities.json"] = exportIdentities
+
+	passkeys, err := cfg.db.GetPasskeysByUser(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportPasskeys := []Passkey{}
+	for _, passkey := range passkeys {
+		exportPasskeys = append(exportPasskeys, passkeyFromDB(passkey))
+	}
+	files["passkeys.json"] = exportPasskeys
+
+	tokens, err := cfg.db.GetPersonalAccessTokens(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	exportTokens := []PersonalAccessToken{}
+	for _, token := range tokens {
+		exportTokens = append(exportTokens, personalAccessTokenFromDB(token))
+	}
+	files["personal_access_tokens.json"] = exportTokens
+
+	preferences, err := cfg.getPreferences(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	files["preferences.json"] = preferences
+
+	zw := zip.NewWriter(f)
+	for name, v := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (cfg *apiConfig) dataExportFromDB(export database.DataExport) DataExport {
+	resp := DataExport{
+		ID:        export.ID,
+		Status:    export.Status,
+		SizeBytes: export.SizeBytes,
+		CreatedAt: export.CreatedAt,
+	}
+	if export.CompletedAt.Valid {
+		resp.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		resp.ExpiresAt = &export.ExpiresAt.Time
+	}
+	if export.Status == dataExportReady && time.Now().Before(export.ExpiresAt.Time) {
+		resp.DownloadURL = cfg.dataExportURL(export.ID, time.Now().Add(dataExportLinkTTL))
+	}
+	return resp
+}
+
+// dataExportURL returns a link to download an export that works until expires.
+func (cfg *apiConfig) dataExportURL(id uuid.UUID, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return fmt.Sprintf("%s/api/exports/%s?expires=%s&signature=%s", cfg.publicURL, id, exp, hex.EncodeToString(cfg.signDataExport(id, exp)))
+}
+
+func (cfg *apiConfig) signDataExport(id uuid.UUID, expires string) []byte {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	mac.Write([]byte("data-export:" + id.String() + ":" + expires))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+)
+
+//go:embed templates/account/*.html
+var accountTemplateFS embed.FS
+
+var accountTemplates = template.Must(template.ParseFS(accountTemplateFS, "templates/account/*.html"))
+
+const emailChangeTTL = 24 * time.Hour
+
+var errEmailTaken = errors.New("email is already in use")
+
+// handlerRequestEmailChange starts an email change. The user confirms it
+// with their password or a passkey, unless they have just logged in with an
+// email link or a passkey. The new address only replaces the old one once the
+// link sent to it is opened, and the old address is told about the request.
+func (cfg *apiConfig) handlerRequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+		confirmation
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	claims, err := auth.ParseJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+	userId, err := claims.UserID()
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected email and password or a passkey, got: %v", err))
+		return
+	}
+	email := strings.TrimSpace(params.Email)
+	if !strings.Contains(email, "@") {
+		WriteError(w, http.StatusBadRequest, errors.New("a valid email is required"))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	// the email is a way back into the account, so a stolen access token
+	// must not be enough to change it
+	if !recentPasswordlessLogin(claims) && !cfg.confirmIdentity(w, r, usr, params.confirmation) {
+		return
+	}
+	if strings.EqualFold(email, usr.Email) {
+		WriteError(w, http.StatusBadRequest, errors.New("that is already your email"))
+		return
+	}
+	if _, err := cfg.db.GetUserByEmail(r.Context(), email); err == nil {
+		WriteError(w, http.StatusConflict, errEmailTaken)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to check email: %v", err))
+		return
+	}
+
+	if err := cfg.sendEmailChangeLink(r.Context(), usr, email); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to send confirmation email: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditEmailChangeRequested, userId, userId, map[string]any{"old_email": usr.Email, "new_email": email})
+
+	WriteJSON(w, http.StatusAccepted, map[string]string{"message": "open the link sent to your new email to confirm the change"})
+}
+
+// handlerEmailChangePage is where confirmation links point. Confirming takes
+// a second step so mail scanners that open links do not use them up.
+func (cfg *apiConfig) handlerEmailChangePage(w http.ResponseWriter, r *http.Request) {
+	renderEmailChangePage(w, http.StatusOK, emailChangePage{Token: r.URL.Query().Get("token")})
+}
+
+// handlerConfirmEmailChange makes the new address the account's email. The
+// link's token is the proof the user owns it, so no access token is needed.
+// The form on the link's page gets HTML back instead of JSON.
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	params := parameters{}
+	fromForm := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if fromForm {
+		params.Token = r.PostFormValue("token")
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	change, err := cfg.db.ConsumeEmailChangeToken(r.Context(), hashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeEmailChangeError(w, fromForm, http.StatusUnauthorized, errors.New("confirmation link is invalid or has already been used"))
+		return
+	} else if err != nil {
+		writeEmailChangeError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to check confirmation link: %v", err))
+		return
+	}
+	if time.Now().After(change.ExpiresAt) {
+		writeEmailChangeError(w, fromForm, http.StatusUnauthorized, errors.New("confirmation link has expired"))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), change.UserID)
+	if err != nil {
+		writeEmailChangeError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if err := checkAccountUsable(usr); err != nil {
+		writeEmailChangeError(w, fromForm, http.StatusForbidden, err)
+		return
+	}
+
+	// another account may have taken the address since the link was sent
+	updated, err := cfg.db.UpdateEmail(r.Context(), database.UpdateEmailParams{ID: usr.ID, Email: change.NewEmail})
+	if isUniqueViolation(err) {
+		writeEmailChangeError(w, fromForm, http.StatusConflict, errEmailTaken)
+		return
+	} else if err != nil {
+		writeEmailChangeError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to update email: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditEmailChanged, usr.ID, usr.ID, map[string]any{"old_email": usr.Email, "new_email": updated.Email})
+
+	err = cfg.mailer.Send(r.Context(), mailer.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy email was changed",
+		Text: fmt.Sprintf("The email of your Chirpy account was changed to %s. Emails about your account will go there from now on.\n\n"+
+			"If you did not do this, contact support.\n", updated.Email),
+	})
+	if err != nil {
+		log.Printf("failed to email user %s about email change: %v", usr.ID, err)
+	}
+
+	if fromForm {
+		renderEmailChangePage(w, http.StatusOK, emailChangePage{Email: updated.Email})
+		return
+	}
+	WriteJSON(w, http.StatusOK, User{
+		ID:          updated.ID,
+		CreatedAt:   updated.CreatedAt,
+		UpdatedAt:   updated.UpdatedAt,
+		Email:       updated.Email,
+		IsChirpyRed: updated.IsChirpyRed,
+		Role:        updated.Role,
+	})
+}
+
+// helpers ---------------------------------------------------------
+
+// sendEmailChangeLink emails a confirmation link to the new address and a
+// notice to the old one. Earlier links of the user stop working.
+func (cfg *apiConfig) sendEmailChangeLink(ctx context.Context, usr database.User, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DeleteExpiredEmailChangeTokens(ctx); err != nil {
+		return err
+	}
+	if err := qtx.DeleteEmailChangeTokensByUser(ctx, usr.ID); err != nil {
+		return err
+	}
+	err = qtx.CreateEmailChangeToken(ctx, database.CreateEmailChangeTokenParams{
+		TokenHash: hashToken(token),
+		UserID:    usr.ID,
+		NewEmail:  email,
+		ExpiresAt: time.Now().Add(emailChangeTTL),
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	link := cfg.publicURL + "/api/users/email/confirm?token=" + url.QueryEscape(token)
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your new Chirpy email",
+		Text: fmt.Sprintf("Open this link to use this address for your Chirpy account:\n\n%s\n\nThe link works once and expires in %d hours. "+
+			"If you did not ask for this, you can ignore this email.\n", link, int(emailChangeTTL.Hours())),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the notice is a courtesy, the change still needs the new address
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy email is being changed",
+		Text: fmt.Sprintf("Someone asked to change the email of your Chirpy account to %s. It changes once the link sent there is opened.\n\n"+
+			"If this was not you, change your password now.\n", email),
+	})
+	if err != nil {
+		log.Printf("failed to send email change notice to user %s: %v", usr.ID, err)
+	}
+	return nil
+}
+
+type emailChangePage struct {
+	Token string
+	Error string
+	// Email is set once the change is confirmed
+	Email string
+}
+
+// writeEmailChangeError responds to a failed confirmation with the error as
+// JSON, or on the link's page when the page's form was used.
+func writeEmailChangeError(w http.ResponseWriter, fromForm bool, status int, err error) {
+	if !fromForm {
+		WriteError(w, status, err)
+		return
+	}
+	renderEmailChangePage(w, status, emailChangePage{Error: err.Error()})
+}
+
+func renderEmailChangePage(w http.ResponseWriter, status int, page emailChangePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := accountTemplates.ExecuteTemplate(w, "email.html", page); err != nil {
+		log.Printf("failed to render email.html: %v", err)
+	}
+}
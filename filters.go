@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/filter"
+	"github.com/google/uuid"
+)
+
+type FilterRule struct {
+	ID        uuid.UUID `json:"id"`
+	Word      string    `json:"word"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ChirpFlag struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	Source    string    `json:"source"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const flagSourceFilter = "filter"
+
+func (cfg *apiConfig) handlerGetFilterRules(w http.ResponseWriter, r *http.Request) {
+	dbRules, err := cfg.db.GetFilterRules(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve filter rules: %v", err))
+		return
+	}
+
+	rules := []FilterRule{}
+	for _, rule := range dbRules {
+		rules = append(rules, FilterRule{ID: rule.ID, Word: rule.Word, Action: rule.Action, CreatedAt: rule.CreatedAt})
+	}
+
+	WriteJSON(w, http.StatusOK, rules)
+}
+
+func (cfg *apiConfig) handlerCreateFilterRule(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Word   string `json:"word"`
+		Action string `json:"action"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected word and action, got: %v", err))
+		return
+	}
+	word := strings.ToLower(strings.TrimSpace(params.Word))
+	if filter.Normalize(word) == "" || strings.ContainsAny(word, " \t\n") {
+		WriteError(w, http.StatusBadRequest, errors.New("word must be a single word"))
+		return
+	}
+	action, err := filter.ParseAction(params.Action)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rule, err := cfg.db.CreateFilterRule(r.Context(), database.CreateFilterRuleParams{Word: word, Action: string(action)})
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, errors.New("a rule for this word already exists"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create filter rule: %v", err))
+		return
+	}
+	if err := cfg.reloadFilter(r.Context()); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to reload filter: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, FilterRule{ID: rule.ID, Word: rule.Word, Action: rule.Action, CreatedAt: rule.CreatedAt})
+}
+
+func (cfg *apiConfig) handlerDeleteFilterRule(w http.ResponseWriter, r *http.Request) {
+	ruleId, err := uuid.Parse(r.PathValue("ruleId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse rule id: %v", err))
+		return
+	}
+
+	n, err := cfg.db.DeleteFilterRule(r.Context(), ruleId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete filter rule: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("filter rule not found"))
+		return
+	}
+	if err := cfg.reloadFilter(r.Context()); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to reload filter: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerGetChirpFlags(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rows, err := cfg.db.GetChirpFlags(r.Context(), database.GetChirpFlagsParams{Limit: limit, Offset: offset})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve flagged chirps: %v", err))
+		return
+	}
+
+	flags := []ChirpFlag{}
+	for _, row := range rows {
+		flags = append(flags, ChirpFlag{
+			ID:        row.ID,
+			ChirpID:   row.ChirpID,
+			UserID:    row.UserID,
+			Body:      row.Body,
+			Source:    row.Source,
+			Reason:    row.Reason,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, flags)
+}
+
+// reloadFilter rebuilds the chirp filter from the configured word list and
+// the rules stored in the database.
+func (cfg *apiConfig) reloadFilter(ctx context.Context) error {
+	dbRules, err := cfg.db.GetFilterRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := append([]filter.Rule{}, cfg.filterRules...)
+	for _, rule := range dbRules {
+		rules = append(rules, filter.Rule{Word: rule.Word, Action: filter.Action(rule.Action)})
+	}
+	cfg.chirpFilter.Store(filter.New(rules))
+	return nil
+}
+
+// refreshFilter reloads the chirp filter every interval until ctx is done, so
+// rules changed through another server take effect here too.
+func (cfg *apiConfig) refreshFilter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.reloadFilter(ctx); err != nil {
+				log.Printf("failed to reload filter: %v", err)
+			}
+		}
+	}
+}
+
+// mergeFiltered combines the matches of several filtered texts, flagging the
+// result when any of them was flagged.
+func mergeFiltered(results ...filter.Result) filter.Result {
+	merged := filter.Result{}
+	for _, result := range results {
+		merged.Flagged = merged.Flagged || result.Flagged
+		merged.Matches = append(merged.Matches, result.Matches...)
+	}
+	return merged
+}
+
+// filterReason describes the flagged words of a filter result for moderators.
+func filterReason(result filter.Result) string {
+	words := []string{}
+	for _, match := range result.Matches {
+		if match.Action == filter.ActionFlag {
+			words = append(words, match.Word)
+		}
+	}
+	return "matched filter words: " + strings.Join(words, ", ")
+}
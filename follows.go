@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	followeeId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse user id: %v", err))
+		return
+	}
+	if followeeId == userId {
+		WriteError(w, http.StatusBadRequest, errors.New("cannot follow yourself"))
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), followeeId); errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("failed to find user"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, errors.New("failed to get user"))
+		return
+	}
+
+	if err := cfg.db.FollowUser(r.Context(), database.FollowUserParams{FollowerID: userId, FolloweeID: followeeId}); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to follow user: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	followeeId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse user id: %v", err))
+		return
+	}
+
+	n, err := cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: userId, FolloweeID: followeeId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to unfollow user: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("not following user"))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultImpersonationTTL = 15 * time.Minute
+	maxImpersonationTTL     = time.Hour
+)
+
+// impersonationHeader is set on every response to a request made with an
+// impersonation token, naming the admin behind it.
+const impersonationHeader = "Chirpy-Impersonated-By"
+
+// handlerImpersonateUser gives an admin an access token that acts as the
+// user, so support can see what the user sees. The token is read-only unless
+// more scopes are asked for, only reaches the routes OAuth clients can, and
+// every request made with it is audited.
+func (cfg *apiConfig) handlerImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason           string   `json:"reason"`
+		Scopes           []string `json:"scopes"`
+		ExpiresInSeconds int      `json:"expires_in_seconds"`
+	}
+	type response struct {
+		User
+		Token         string    `json:"token"`
+		Scopes        []string  `json:"scopes"`
+		ExpiresAt     time.Time `json:"expires_at"`
+		Impersonation bool      `json:"impersonation"`
+	}
+	const maxReasonLength = 500
+
+	adminId := userIDFromContext(r.Context())
+
+	usr, ok := cfg.getPathUser(w, r)
+	if !ok {
+		return
+	}
+	if usr.ID == adminId {
+		WriteError(w, http.StatusBadRequest, errors.New("cannot impersonate yourself"))
+		return
+	}
+	// staff powers are never reachable through another account
+	if auth.Role(usr.Role) != auth.RoleUser {
+		WriteError(w, http.StatusForbidden, errors.New("staff accounts cannot be impersonated"))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected reason, got: %v", err))
+		return
+	}
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		WriteError(w, http.StatusBadRequest, errors.New("reason is required"))
+		return
+	}
+	if len(reason) > maxReasonLength {
+		WriteError(w, http.StatusBadRequest, errors.New("reason is too long"))
+		return
+	}
+	if len(params.Scopes) == 0 {
+		params.Scopes = []string{string(auth.ScopeRead)}
+	}
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ttl := defaultImpersonationTTL
+	if params.ExpiresInSeconds < 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("expires_in_seconds cannot be negative"))
+		return
+	} else if params.ExpiresInSeconds > 0 {
+		ttl = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	if ttl > maxImpersonationTTL {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("impersonation tokens last at most %v", maxImpersonationTTL))
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	token, err := auth.MakeImpersonationJWT(usr.ID, auth.Role(usr.Role), adminId, scopes, cfg.jwtSecret, ttl)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create token: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditImpersonationStarted, adminId, usr.ID, map[string]any{
+		"reason":     reason,
+		"scopes":     auth.FormatScopes(scopes),
+		"expires_at": expiresAt,
+	})
+
+	WriteJSON(w, http.StatusCreated, response{
+		User: User{
+			ID:          usr.ID,
+			CreatedAt:   usr.CreatedAt,
+			UpdatedAt:   usr.UpdatedAt,
+			Email:       usr.Email,
+			IsChirpyRed: usr.IsChirpyRed,
+			Role:        usr.Role,
+		},
+		Token:         token,
+		Scopes:        strings.Fields(auth.FormatScopes(scopes)),
+		ExpiresAt:     expiresAt,
+		Impersonation: true,
+	})
+}
+
+// helpers ---------------------------------------------------------
+
+// checkImpersonation flags the response to a request made with an
+// impersonation token and audits the request. The admin must still be an
+// admin in good standing, so demoting them ends their impersonation at once.
+// It writes the response and returns false when the request is refused.
+func (cfg *apiConfig) checkImpersonation(w http.ResponseWriter, r *http.Request, claims *auth.Claims) bool {
+	adminId := claims.ImpersonatorID()
+	if adminId == uuid.Nil {
+		return true
+	}
+
+	admin, err := cfg.db.GetUserByID(r.Context(), adminId)
+	if err != nil || !auth.Role(admin.Role).Allows(auth.RoleAdmin) || checkAccountUsable(admin) != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		WriteError(w, http.StatusUnauthorized, errors.New("impersonation token is no longer valid"))
+		return false
+	}
+
+	userId, _ := claims.UserID()
+	cfg.recordAudit(r, auditImpersonatedRequest, adminId, userId, map[string]any{"method": r.Method, "path": r.URL.Path})
+	w.Header().Set(impersonationHeader, adminId.String())
+	return true
+}
@@ -6,12 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenType string
@@ -20,28 +20,102 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 )
 
-func HashPassword(password string) (string, error) {
-	hashed_pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// Claims are the claims of an access token.
+type Claims struct {
+	Role Role `json:"role"`
+	// Scope is only set on tokens issued to OAuth clients, with their
+	// ClientID and GrantID, or for personal access tokens, with their TokenID
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	GrantID  string `json:"grant_id,omitempty"`
+	TokenID  string `json:"token_id,omitempty"`
+	// Actor is only set on impersonation tokens: the admin acting as the
+	// subject, in the form of the RFC 8693 act claim
+	Actor *Actor `json:"act,omitempty"`
+	// AuthMethods say how the user logged in, in the form of the RFC 8176
+	// amr claim. Only the token issued at login has them, refreshed ones do not.
+	AuthMethods []string `json:"amr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is who is acting for the subject of a token.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
 	if err != nil {
-		return "", err 
+		return uuid.Nil, fmt.Errorf("failed to parse UUID from subject: %w", err)
 	}
-	return string(hashed_pw), nil
+	return id, nil
+}
+
+func MakeJWT(userID uuid.UUID, role Role, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{Role: role}, userID, tokenSecret, expiresIn)
+}
+
+// MakeLoginJWT makes the access token issued when a user logs in, recording
+// how they did.
+func MakeLoginJWT(userID uuid.UUID, role Role, methods []string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{Role: role, AuthMethods: methods}, userID, tokenSecret, expiresIn)
+}
+
+// LoggedInWith reports whether the token was issued at a login with method.
+func (c *Claims) LoggedInWith(method string) bool {
+	return slices.Contains(c.AuthMethods, method)
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// MakeScopedJWT makes an access token for an OAuth client that only allows
+// what the user granted it.
+func MakeScopedJWT(userID uuid.UUID, role Role, clientID string, grantID uuid.UUID, scopes []Scope, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{
+		Role:     role,
+		Scope:    FormatScopes(scopes),
+		ClientID: clientID,
+		GrantID:  grantID.String(),
+	}, userID, tokenSecret, expiresIn)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256, 
-		jwt.RegisteredClaims {
-			Issuer: string(TokenTypeAccess), 
-			IssuedAt: jwt.NewNumericDate(time.Now().UTC()), 
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-			Subject: userID.String(),
-		},
-	)
+// MakePersonalAccessJWT makes a short-lived access token standing in for a
+// personal access token, limited to the personal access token's scopes.
+func MakePersonalAccessJWT(userID uuid.UUID, role Role, tokenID uuid.UUID, scopes []Scope, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{
+		Role:    role,
+		Scope:   FormatScopes(scopes),
+		TokenID: tokenID.String(),
+	}, userID, tokenSecret, expiresIn)
+}
+
+// MakeImpersonationJWT makes an access token that lets an admin act as the
+// user, limited to scopes. The admin stays recorded in the token.
+func MakeImpersonationJWT(userID uuid.UUID, role Role, actorID uuid.UUID, scopes []Scope, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signJWT(Claims{
+		Role:  role,
+		Scope: FormatScopes(scopes),
+		Actor: &Actor{Subject: actorID.String()},
+	}, userID, tokenSecret, expiresIn)
+}
+
+// ImpersonatorID returns the admin acting through an impersonation token, or
+// uuid.Nil for every other token.
+func (c *Claims) ImpersonatorID() uuid.UUID {
+	if c.Actor == nil {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(c.Actor.Subject)
+	return id
+}
+
+func signJWT(claims Claims, userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims {
+		Issuer: string(TokenTypeAccess), 
+		IssuedAt: jwt.NewNumericDate(time.Now().UTC()), 
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		Subject: userID.String(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenStr, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -52,7 +126,16 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+	claims, err := ParseJWT(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+// ParseJWT validates an access token and returns its claims.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	claims := Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
 		// Check the signing method
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -61,32 +144,47 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		return []byte(tokenSecret), nil
 	})
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	str, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to get subject from claims: %w", err)
+	if claims.Issuer != string(TokenTypeAccess) {
+		return nil, errors.New("invalid issuer")
 	}
 
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil {
-		return uuid.Nil, err
-	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+	// tokens issued before roles existed carry no role claim
+	if claims.Role == "" {
+		claims.Role = RoleUser
 	}
 
-	id, err := uuid.Parse(str)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to parse UUID from subject: %w", err)
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	if claims.Delegated() {
+		if _, err := ParseScopes(claims.Scope); err != nil {
+			return nil, err
+		}
+	}
+	if claims.ClientID != "" {
+		if _, err := uuid.Parse(claims.GrantID); err != nil {
+			return nil, fmt.Errorf("invalid grant id: %w", err)
+		}
+	}
+	if claims.TokenID != "" {
+		if _, err := uuid.Parse(claims.TokenID); err != nil {
+			return nil, fmt.Errorf("invalid token id: %w", err)
+		}
+	}
+	if claims.Actor != nil {
+		if _, err := uuid.Parse(claims.Actor.Subject); err != nil {
+			return nil, fmt.Errorf("invalid actor: %w", err)
+		}
 	}
 
-	return id, nil
+	return &claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -113,6 +211,22 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// PersonalAccessTokenPrefix starts every personal access token, telling them
+// apart from access tokens and letting secret scanners find leaked ones.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authorization := headers.Get("authorization")
 	if authorization == "" {
@@ -1,10 +1,23 @@
 package auth
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCheckPasswordHash(t *testing.T) {
@@ -64,7 +77,7 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	validToken, _ := MakeJWT(userID, RoleUser, "secret", time.Hour)
 
 	tests := []struct {
 		name        string
@@ -109,3 +122,557 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestParseJWT(t *testing.T) {
+	userID := uuid.New()
+	adminToken, _ := MakeJWT(userID, RoleAdmin, "secret", time.Hour)
+	expiredToken, _ := MakeJWT(userID, RoleAdmin, "secret", -time.Minute)
+
+	claims, err := ParseJWT(adminToken, "secret")
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Role != RoleAdmin {
+		t.Errorf("ParseJWT() role = %v, want %v", claims.Role, RoleAdmin)
+	}
+	if id, _ := claims.UserID(); id != userID {
+		t.Errorf("ParseJWT() user id = %v, want %v", id, userID)
+	}
+
+	if _, err := ParseJWT(expiredToken, "secret"); err == nil {
+		t.Errorf("ParseJWT() expected error for expired token")
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{role: RoleUser, required: RoleUser, want: true},
+		{role: RoleUser, required: RoleModerator, want: false},
+		{role: RoleModerator, required: RoleModerator, want: true},
+		{role: RoleModerator, required: RoleAdmin, want: false},
+		{role: RoleAdmin, required: RoleModerator, want: true},
+		{role: RoleAdmin, required: RoleAdmin, want: true},
+		{role: "", required: RoleUser, want: false},
+		{role: RoleAdmin, required: "superuser", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		MaxAttempts:     8,
+		LockoutDuration: 15 * time.Minute,
+	}
+	last := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 6, want: 4 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 15 * time.Minute},
+		{failures: 20, want: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.RetryAt(tt.failures, last).Sub(last); got != tt.want {
+			t.Errorf("RetryAt(%d) = last + %v, want last + %v", tt.failures, got, tt.want)
+		}
+	}
+
+	if got := (LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: 10 * time.Second}).Delay(40); got != 10*time.Second {
+		t.Errorf("Delay(40) = %v, want the maximum", got)
+	}
+}
+
+func TestCheckDummyPassword(t *testing.T) {
+	if err := CheckDummyPassword(""); err == nil {
+		t.Errorf("CheckDummyPassword() accepted a password")
+	}
+}
+
+func TestCheckPasswordHashLongPasswords(t *testing.T) {
+	// bcrypt ignores everything after 72 bytes
+	prefix := strings.Repeat("a", 72)
+	hash, err := HashPassword(prefix + "one")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if err := CheckPasswordHash(prefix+"two", hash); err == nil {
+		t.Errorf("CheckPasswordHash() accepted a password differing after 72 bytes")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	defer SetHashParams(DefaultArgon2Params)
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err := CheckPasswordHash("password", string(legacy)); err != nil {
+		t.Fatalf("CheckPasswordHash() rejected a bcrypt hash: %v", err)
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Errorf("NeedsRehash() = false for a bcrypt hash")
+	}
+
+	current, _ := HashPassword("password")
+	if NeedsRehash(current) {
+		t.Errorf("NeedsRehash() = true for a hash with current parameters")
+	}
+
+	stronger := DefaultArgon2Params
+	stronger.Iterations++
+	if err := SetHashParams(stronger); err != nil {
+		t.Fatalf("SetHashParams() error = %v", err)
+	}
+	if !NeedsRehash(current) {
+		t.Errorf("NeedsRehash() = false after the parameters changed")
+	}
+	if err := CheckPasswordHash("password", current); err != nil {
+		t.Errorf("CheckPasswordHash() rejected a hash with old parameters: %v", err)
+	}
+
+	if err := SetHashParams(Argon2Params{}); err == nil {
+		t.Errorf("SetHashParams() accepted empty parameters")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// the hash is of "password123"
+	os.WriteFile(path, []byte("letmein123\nCBFDAC6008F9CAB4083784CBD1874F76618D2A97:2254650\n"), 0o600)
+
+	policy := DefaultPasswordPolicy()
+	if err := policy.LoadBreachedPasswords(path); err != nil {
+		t.Fatalf("LoadBreachedPasswords() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "Acceptable", password: "correct horse battery", wantErr: false},
+		{name: "Too short", password: "short", wantErr: true},
+		{name: "Too long", password: strings.Repeat("a", 257), wantErr: true},
+		{name: "Same as email", password: "Test@Email.com", wantErr: true},
+		{name: "Breached in plain text", password: "letmein123", wantErr: true},
+		{name: "Breached by hash", password: "password123", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "test@email.com")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScopedJWT(t *testing.T) {
+	userID := uuid.New()
+	grantID := uuid.New()
+	token, err := MakeScopedJWT(userID, RoleAdmin, "client", grantID, []Scope{ScopeRead, ScopeFollow}, "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() error = %v", err)
+	}
+
+	claims, err := ParseJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if !claims.Delegated() || claims.GrantID != grantID.String() {
+		t.Errorf("ParseJWT() claims = %+v, want a delegated token for the grant", claims)
+	}
+	if !claims.HasScope(ScopeRead) || !claims.HasScope(ScopeFollow) || claims.HasScope(ScopeWrite) {
+		t.Errorf("ParseJWT() scope = %q, want read and follow only", claims.Scope)
+	}
+
+	userToken, _ := MakeJWT(userID, RoleUser, "secret", time.Hour)
+	userClaims, _ := ParseJWT(userToken, "secret")
+	if userClaims.Delegated() || !userClaims.HasScope(ScopeDM) {
+		t.Errorf("tokens issued to the user should allow every scope")
+	}
+}
+
+func TestPersonalAccessJWT(t *testing.T) {
+	tokenID := uuid.New()
+	token, err := MakePersonalAccessJWT(uuid.New(), RoleUser, tokenID, []Scope{ScopeWrite}, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("MakePersonalAccessJWT() error = %v", err)
+	}
+
+	claims, err := ParseJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if !claims.Delegated() || claims.TokenID != tokenID.String() || claims.GrantID != "" {
+		t.Errorf("ParseJWT() claims = %+v, want a delegated token for the personal access token", claims)
+	}
+	if !claims.HasScope(ScopeWrite) || claims.HasScope(ScopeRead) {
+		t.Errorf("ParseJWT() scope = %q, want write only", claims.Scope)
+	}
+
+	pat, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(pat) || IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken() should only accept personal access tokens")
+	}
+}
+
+func TestImpersonationJWT(t *testing.T) {
+	userID := uuid.New()
+	adminID := uuid.New()
+	token, err := MakeImpersonationJWT(userID, RoleUser, adminID, []Scope{ScopeRead}, "secret", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeImpersonationJWT() error = %v", err)
+	}
+
+	claims, err := ParseJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if id, _ := claims.UserID(); id != userID {
+		t.Errorf("ParseJWT() subject = %v, want the impersonated user %v", id, userID)
+	}
+	if !claims.Delegated() || claims.ImpersonatorID() != adminID {
+		t.Errorf("ParseJWT() claims = %+v, want a delegated token acted on by %v", claims, adminID)
+	}
+	if !claims.HasScope(ScopeRead) || claims.HasScope(ScopeWrite) {
+		t.Errorf("ParseJWT() scope = %q, want read only", claims.Scope)
+	}
+
+	userToken, _ := MakeJWT(userID, RoleUser, "secret", time.Hour)
+	userClaims, _ := ParseJWT(userToken, "secret")
+	if userClaims.ImpersonatorID() != uuid.Nil {
+		t.Errorf("ImpersonatorID() = %v for a token issued to the user, want uuid.Nil", userClaims.ImpersonatorID())
+	}
+}
+
+func TestLoginJWT(t *testing.T) {
+	userID := uuid.New()
+	token, err := MakeLoginJWT(userID, RoleUser, []string{"magic_link"}, "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeLoginJWT() error = %v", err)
+	}
+	claims, err := ParseJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if !claims.LoggedInWith("magic_link") || claims.LoggedInWith("passkey") || claims.Delegated() {
+		t.Errorf("ParseJWT() claims = %+v, want an undelegated magic_link login", claims)
+	}
+
+	userToken, _ := MakeJWT(userID, RoleUser, "secret", time.Hour)
+	userClaims, _ := ParseJWT(userToken, "secret")
+	if userClaims.LoggedInWith("magic_link") {
+		t.Errorf("LoggedInWith() = true for a token without login methods")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "", want: ""},
+		{input: "read write", want: "read write"},
+		{input: "  follow read follow ", want: "follow read"},
+		{input: "read admin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseScopes(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseScopes(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && FormatScopes(got) != tt.want {
+			t.Errorf("ParseScopes(%q) = %q, want %q", tt.input, FormatScopes(got), tt.want)
+		}
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// the example from RFC 7636 appendix B
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name     string
+		verifier string
+		method   string
+		wantErr  bool
+	}{
+		{name: "Matching verifier", verifier: verifier, method: "S256", wantErr: false},
+		{name: "Wrong verifier", verifier: strings.Repeat("a", 43), method: "S256", wantErr: true},
+		{name: "Short verifier", verifier: "abc", method: "S256", wantErr: true},
+		{name: "Plain method", verifier: challenge, method: "plain", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyPKCE(tt.verifier, challenge, tt.method)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyPKCE() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    any
+		wantErr bool
+	}{
+		{name: "Small integer", input: "17", want: int64(23)},
+		{name: "Two byte integer", input: "190100", want: int64(256)},
+		{name: "Negative integer", input: "3901ff", want: int64(-512)},
+		{name: "Byte string", input: "43010203", want: []byte{1, 2, 3}},
+		{name: "Text string", input: "6161", want: "a"},
+		{name: "Array", input: "83010203", want: []any{int64(1), int64(2), int64(3)}},
+		{name: "Map", input: "a2016161206162", want: map[any]any{int64(1): "a", int64(-1): "b"}},
+		{name: "Booleans and null", input: "83f4f5f6", want: []any{false, true, nil}},
+		{name: "Truncated byte string", input: "4401", wantErr: true},
+		{name: "Array longer than its data", input: "9bffffffffffffffff", wantErr: true},
+		{name: "Indefinite length", input: "5f4101ff", wantErr: true},
+		{name: "Duplicate map key", input: "a201010102", wantErr: true},
+		{name: "Float", input: "f93c00", wantErr: true},
+		{name: "Tag", input: "c11a514b67b0", wantErr: true},
+		{name: "Nested too deeply", input: strings.Repeat("81", 20) + "01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			got, rest, err := decodeCBOR(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCBOR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!reflect.DeepEqual(got, tt.want) || len(rest) != 0) {
+				t.Errorf("decodeCBOR() = %#v, rest %x, want %#v", got, rest, tt.want)
+			}
+		})
+	}
+}
+
+// softAuthenticator is a passkey authenticator in software, with one ES256
+// credential.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: []byte("credential-1"), flags: flagUserPresent | flagUserVerified}
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]any{"type": ceremony, "challenge": challenge, "origin": origin, "crossOrigin": false})
+	return data
+}
+
+func (a *softAuthenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredential
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	return cborMap(
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(COSEAlgES256),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+}
+
+func (a *softAuthenticator) register(rpID, challenge, origin string) (clientDataJSON, attestationObject []byte) {
+	attestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(rpID, true)),
+	)
+	return a.clientData("webauthn.create", challenge, origin), attestationObject
+}
+
+func (a *softAuthenticator) login(rpID, challenge, origin string) PasskeyAssertion {
+	a.signCount++
+	clientDataJSON := a.clientData("webauthn.get", challenge, origin)
+	authData := a.authData(rpID, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("failed to sign: %v", err)
+	}
+	return PasskeyAssertion{ClientDataJSON: clientDataJSON, AuthenticatorData: authData, Signature: sig}
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	}
+}
+
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(1, uint64(-1-n))
+	}
+	return cborHead(0, uint64(n))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, uint64(len(s))), s...) }
+
+// cborMap encodes alternating keys and values.
+func cborMap(items ...[]byte) []byte {
+	data := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		data = append(data, item...)
+	}
+	return data
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	const origin = "https://chirpy.example.com"
+	rp := RelyingParty{ID: "chirpy.example.com", Name: "Chirpy", Origins: []string{origin}}
+	authenticator := newSoftAuthenticator(t)
+
+	challenge, err := NewPasskeyChallenge()
+	if err != nil {
+		t.Fatalf("NewPasskeyChallenge() error = %v", err)
+	}
+	clientDataJSON, attestationObject := authenticator.register(rp.ID, challenge, origin)
+	passkey, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	if string(passkey.CredentialID) != "credential-1" {
+		t.Errorf("VerifyRegistration() credential id = %q, want credential-1", passkey.CredentialID)
+	}
+
+	clientDataJSON, attestationObject = authenticator.register("evil.example.com", challenge, origin)
+	if _, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject, true); err == nil {
+		t.Errorf("VerifyRegistration() accepted a passkey for another relying party")
+	}
+
+	tests := []struct {
+		name      string
+		assertion func() PasskeyAssertion
+		wantErr   error
+	}{
+		{
+			name:      "Valid assertion",
+			assertion: func() PasskeyAssertion { return authenticator.login(rp.ID, challenge, origin) },
+		},
+		{
+			name:      "Wrong challenge",
+			assertion: func() PasskeyAssertion { return authenticator.login(rp.ID, "other-challenge", origin) },
+			wantErr:   ErrInvalidPasskey,
+		},
+		{
+			name:      "Wrong origin",
+			assertion: func() PasskeyAssertion { return authenticator.login(rp.ID, challenge, "https://evil.example.com") },
+			wantErr:   ErrInvalidPasskey,
+		},
+		{
+			name: "Registration client data",
+			assertion: func() PasskeyAssertion {
+				assertion := authenticator.login(rp.ID, challenge, origin)
+				assertion.ClientDataJSON = authenticator.clientData("webauthn.create", challenge, origin)
+				return assertion
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+		{
+			name: "Tampered authenticator data",
+			assertion: func() PasskeyAssertion {
+				assertion := authenticator.login(rp.ID, challenge, origin)
+				assertion.AuthenticatorData[36]++
+				return assertion
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+		{
+			name: "User not verified",
+			assertion: func() PasskeyAssertion {
+				authenticator.flags = flagUserPresent
+				defer func() { authenticator.flags = flagUserPresent | flagUserVerified }()
+				return authenticator.login(rp.ID, challenge, origin)
+			},
+			wantErr: ErrInvalidPasskey,
+		},
+		{
+			name: "Cloned authenticator",
+			assertion: func() PasskeyAssertion {
+				authenticator.signCount = 0
+				return authenticator.login(rp.ID, challenge, origin)
+			},
+			wantErr: ErrSignCountRegressed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signCount, err := rp.VerifyAssertion(challenge, passkey, tt.assertion(), true)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("VerifyAssertion() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				passkey.SignCount = signCount
+			}
+		})
+	}
+}
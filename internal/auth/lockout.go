@@ -0,0 +1,68 @@
+package auth
+
+import "time"
+
+// LockoutPolicy slows down and then stops password guessing. After
+// FreeAttempts failures each further attempt has to wait, twice as long
+// as the one before, and after MaxAttempts failures attempts are refused
+// for LockoutDuration.
+type LockoutPolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+var (
+	// AccountLockoutPolicy applies to failed logins for one account.
+	AccountLockoutPolicy = LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		MaxAttempts:     10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	// IPLockoutPolicy applies to failed logins from one IP address. It is
+	// looser since many users can share an address.
+	IPLockoutPolicy = LockoutPolicy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		MaxAttempts:     50,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// Delay returns how long to wait after the last of failures before trying again.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Locks reports whether failures is enough to lock out further attempts.
+func (p LockoutPolicy) Locks(failures int) bool {
+	return p.MaxAttempts > 0 && failures >= p.MaxAttempts
+}
+
+// RetryAt returns when the next attempt is allowed after failures, the last
+// of which happened at lastFailure.
+func (p LockoutPolicy) RetryAt(failures int, lastFailure time.Time) time.Time {
+	if p.Locks(failures) {
+		return lastFailure.Add(p.LockoutDuration)
+	}
+	return lastFailure.Add(p.Delay(failures))
+}
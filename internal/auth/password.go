@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2Params are the cost parameters of Argon2id hashes. They are stored
+// in every hash so they can be raised without breaking existing passwords.
+type Argon2Params struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func (p Argon2Params) Validate() error {
+	if p.Iterations < 1 || p.Parallelism < 1 {
+		return errors.New("iterations and parallelism must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return errors.New("memory must be at least 8 KiB per thread")
+	}
+	if p.SaltLength < 8 || p.KeyLength < 16 {
+		return errors.New("salt must be at least 8 bytes and key at least 16 bytes")
+	}
+	return nil
+}
+
+var (
+	hashParamsMu sync.RWMutex
+	hashParams   = DefaultArgon2Params
+)
+
+// SetHashParams changes the parameters of new hashes. Passwords hashed with
+// other parameters are reported by NeedsRehash.
+func SetHashParams(p Argon2Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	hashParamsMu.Lock()
+	defer hashParamsMu.Unlock()
+	hashParams = p
+	return nil
+}
+
+func currentHashParams() Argon2Params {
+	hashParamsMu.RLock()
+	defer hashParamsMu.RUnlock()
+	return hashParams
+}
+
+const argon2Prefix = "$argon2id$"
+
+// HashPassword hashes a password with Argon2id. The hash is encoded as
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+func HashPassword(password string) (string, error) {
+	p := currentHashParams()
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPasswordHash compares a password with an Argon2id hash or a bcrypt
+// hash from before Argon2id was used.
+func CheckPasswordHash(password, hash string) error {
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	p, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return errors.New("password does not match hash")
+	}
+	return nil
+}
+
+// NeedsRehash reports whether a hash was made with bcrypt or with other
+// parameters than HashPassword uses now. It should be replaced the next
+// time the password is known, i.e. after a successful login.
+func NeedsRehash(hash string) bool {
+	p, _, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	current := currentHashParams()
+	return p.Memory != current.Memory || p.Iterations != current.Iterations || p.Parallelism != current.Parallelism ||
+		p.SaltLength != current.SaltLength || p.KeyLength != current.KeyLength
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	if err := p.Validate(); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	return p, salt, key, nil
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// CheckDummyPassword takes as long as CheckPasswordHash but always fails. It
+// is used for unknown users so response times do not tell which emails have
+// accounts.
+func CheckDummyPassword(password string) error {
+	dummyHashOnce.Do(func() {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		dummyHash, _ = HashPassword(hex.EncodeToString(secret))
+	})
+	CheckPasswordHash(password, dummyHash)
+	return errors.New("password does not match hash")
+}
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength bounds the work of hashing a password
+	MaxLength int
+	// breached holds upper case hex SHA-1 hashes of known breached passwords
+	breached map[string]struct{}
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MaxLength: 256}
+}
+
+// LoadBreachedPasswords adds the passwords in a file to the ones the policy
+// refuses. The file has one password per line, or one SHA-1 hash per line
+// optionally followed by ":<count>" as in the Pwned Passwords downloads.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if p.breached == nil {
+		p.breached = map[string]struct{}{}
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Check returns why a password is not allowed, or nil. email is the account's
+// email, which may not be used as the password.
+func (p PasswordPolicy) Check(password, email string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters", p.MaxLength)
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		return errors.New("password cannot be the email address")
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return errors.New("password appears in a list of breached passwords, choose another")
+	}
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,38 @@
+package auth
+
+import "fmt"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// ParseRole validates a role name.
+func ParseRole(s string) (Role, error) {
+	switch role := Role(s); role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown role %q", s)
+}
+
+// Allows reports whether the role grants at least the access of required.
+// Admins can do everything moderators can.
+func (r Role) Allows(required Role) bool {
+	return rank(r) >= rank(required) && rank(required) > 0
+}
+
+func rank(r Role) int {
+	switch r {
+	case RoleUser:
+		return 1
+	case RoleModerator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
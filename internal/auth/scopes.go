@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Scope limits what an OAuth client may do with a user's account.
+type Scope string
+
+const (
+	ScopeRead   Scope = "read"
+	ScopeWrite  Scope = "write"
+	ScopeDM     Scope = "dm"
+	ScopeFollow Scope = "follow"
+)
+
+var AllScopes = []Scope{ScopeRead, ScopeWrite, ScopeDM, ScopeFollow}
+
+// ParseScopes parses a space separated list of scopes as used in OAuth
+// requests. Duplicates are dropped.
+func ParseScopes(s string) ([]Scope, error) {
+	scopes := []Scope{}
+	for _, name := range strings.Fields(s) {
+		scope := Scope(name)
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func FormatScopes(scopes []Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, " ")
+}
+
+// Delegated reports whether the token was issued to an OAuth client, for a
+// personal access token or to an admin impersonating the user rather than to
+// the user.
+func (c *Claims) Delegated() bool {
+	return c.ClientID != "" || c.TokenID != "" || c.Actor != nil
+}
+
+// HasScope reports whether the token allows scope. Tokens issued to the user
+// allow everything.
+func (c *Claims) HasScope(scope Scope) bool {
+	if !c.Delegated() {
+		return true
+	}
+	return slices.Contains(strings.Fields(c.Scope), string(scope))
+}
+
+var pkceVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// VerifyPKCE checks a PKCE code verifier against the challenge sent with the
+// authorization request. Only the S256 method is supported.
+func VerifyPKCE(verifier, challenge, method string) error {
+	if method != "S256" {
+		return fmt.Errorf("unsupported code challenge method %q", method)
+	}
+	if !pkceVerifierPattern.MatchString(verifier) {
+		return errors.New("code verifier must be 43 to 128 unreserved characters")
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) != 1 {
+		return errors.New("code verifier does not match challenge")
+	}
+	return nil
+}
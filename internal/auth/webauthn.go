@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// COSE algorithm identifiers of the passkey signatures we can check.
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+// PasskeyAlgorithms are offered to authenticators in order of preference.
+var PasskeyAlgorithms = []int64{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256}
+
+var (
+	ErrInvalidPasskey = errors.New("passkey response could not be verified")
+	// ErrSignCountRegressed means the authenticator's signature counter did not
+	// go up, which happens when a credential has been cloned.
+	ErrSignCountRegressed = errors.New("passkey signature counter went backwards, the passkey may have been cloned")
+)
+
+// authenticator data flags, see the WebAuthn spec section 6.1
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+	flagExtensions         = 0x80
+)
+
+// RelyingParty is this server as passkeys see it. Passkeys are bound to ID, a
+// domain, and ceremonies must run in a page served from one of Origins.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Passkey is a registered credential.
+type Passkey struct {
+	CredentialID []byte
+	// PublicKey is the credential's key as a COSE_Key
+	PublicKey []byte
+	SignCount uint32
+}
+
+// PasskeyAssertion is an authenticator's response to a login challenge.
+type PasskeyAssertion struct {
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+// NewPasskeyChallenge returns a random challenge for a ceremony, encoded the
+// way it appears in the client data.
+func NewPasskeyChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// VerifyRegistration checks an authenticator's response to a registration
+// challenge and returns the new passkey. We ask for no attestation, so the
+// attestation statement is not checked whatever its format.
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte, requireUserVerification bool) (Passkey, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Passkey{}, err
+	}
+
+	obj, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return Passkey{}, fmt.Errorf("%w: malformed attestation object", ErrInvalidPasskey)
+	}
+	m, _ := obj.(map[any]any)
+	rawAuthData, ok := m["authData"].([]byte)
+	if !ok {
+		return Passkey{}, fmt.Errorf("%w: attestation object has no authenticator data", ErrInvalidPasskey)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Passkey{}, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUserVerification); err != nil {
+		return Passkey{}, err
+	}
+	if authData.flags&flagAttestedCredential == 0 {
+		return Passkey{}, fmt.Errorf("%w: no credential in authenticator data", ErrInvalidPasskey)
+	}
+	if _, _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return Passkey{}, err
+	}
+
+	return Passkey{
+		CredentialID: authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks an authenticator's response to a login challenge
+// against the stored passkey and returns the passkey's new signature count.
+// It returns ErrSignCountRegressed for a valid signature from a counter that
+// did not go up.
+func (rp RelyingParty) VerifyAssertion(challenge string, passkey Passkey, assertion PasskeyAssertion, requireUserVerification bool) (uint32, error) {
+	if err := rp.checkClientData(assertion.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	authData, err := parseAuthenticatorData(assertion.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUserVerification); err != nil {
+		return 0, err
+	}
+
+	key, alg, err := parseCOSEKey(passkey.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(assertion.ClientDataJSON)
+	signed := append(slices.Clip(assertion.AuthenticatorData), clientDataHash[:]...)
+	if !verifyPasskeySignature(key, alg, signed, assertion.Signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrInvalidPasskey)
+	}
+
+	// authenticators without a counter always report 0
+	if (authData.signCount != 0 || passkey.SignCount != 0) && authData.signCount <= passkey.SignCount {
+		return 0, ErrSignCountRegressed
+	}
+	return authData.signCount, nil
+}
+
+func (rp RelyingParty) checkClientData(raw []byte, ceremony, challenge string) error {
+	clientData := struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}{}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("%w: malformed client data", ErrInvalidPasskey)
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: client data is for %q", ErrInvalidPasskey, clientData.Type)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge does not match", ErrInvalidPasskey)
+	}
+	if !slices.Contains(rp.Origins, clientData.Origin) || clientData.CrossOrigin {
+		return fmt.Errorf("%w: unexpected origin %q", ErrInvalidPasskey, clientData.Origin)
+	}
+	return nil
+}
+
+func (rp RelyingParty) checkAuthenticatorData(authData authenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: passkey is for another site", ErrInvalidPasskey)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user was not present", ErrInvalidPasskey)
+	}
+	if requireUserVerification && authData.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user was not verified", ErrInvalidPasskey)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// credentialID and publicKey are only set during registration
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data too short", ErrInvalidPasskey)
+	}
+	authData := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedCredential != 0 {
+		// a 16 byte authenticator model ID, then the credential ID and its length
+		if len(rest) < 18 {
+			return authenticatorData{}, fmt.Errorf("%w: attested credential data too short", ErrInvalidPasskey)
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return authenticatorData{}, fmt.Errorf("%w: invalid credential id", ErrInvalidPasskey)
+		}
+		authData.credentialID = bytes.Clone(rest[:n])
+		rest = rest[n:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: malformed public key: %v", ErrInvalidPasskey, err)
+		}
+		authData.publicKey = bytes.Clone(rest[:len(rest)-len(after)])
+		rest = after
+	}
+	if authData.flags&flagExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: malformed extensions: %v", ErrInvalidPasskey, err)
+		}
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, fmt.Errorf("%w: trailing bytes in authenticator data", ErrInvalidPasskey)
+	}
+	return authData, nil
+}
+
+// parseCOSEKey decodes a COSE_Key (RFC 9053) of one of PasskeyAlgorithms.
+func parseCOSEKey(data []byte) (crypto.PublicKey, int64, error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil || len(rest) != 0 {
+		return nil, 0, fmt.Errorf("%w: malformed public key", ErrInvalidPasskey)
+	}
+	m, _ := v.(map[any]any)
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			break
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			break
+		}
+		return key, alg, nil
+	case kty == 1 && alg == COSEAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			break
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			break
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported public key", ErrInvalidPasskey)
+}
+
+func verifyPasskeySignature(key crypto.PublicKey, alg int64, signed, sig []byte) bool {
+	switch alg {
+	case COSEAlgES256:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], sig)
+	case COSEAlgEdDSA:
+		return ed25519.Verify(key.(ed25519.PublicKey), signed, sig)
+	case COSEAlgRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,393 @@
+// Package config loads the server's settings. Each setting can come from,
+// in increasing order of precedence: its default, a YAML or TOML config
+// file, a .env file, the environment and a command-line flag.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/netip"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	PlatformDev        = "dev"
+	PlatformProduction = "production"
+)
+
+// minSecretLength is the shortest JWT secret accepted in production. Tokens
+// are signed with HMAC-SHA256, so anything shorter than its output is weak.
+const minSecretLength = 32
+
+// Secret is a setting that must not be logged. It prints as [redacted].
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+// Value returns the secret itself.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// Config holds every setting. The env tag names a setting's environment
+// variable; its config file key is the same name in lower case and its flag
+// the lower case name with dashes, so DB_URL is db_url and -db-url.
+type Config struct {
+	Port     string `env:"PORT" default:"8080" usage:"port to listen on"`
+	FileRoot string `env:"FILE_ROOT" default:"." usage:"directory the /app/ files are served from"`
+	// Platform is dev or production. Dangerous endpoints only work in dev.
+	Platform string `env:"PLATFORM" default:"production" usage:"dev or production"`
+
+	// ShutdownTimeout is how long in-flight requests and background work
+	// get to finish once the server is asked to stop
+	ShutdownTimeout   time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s" usage:"time to finish requests on shutdown"`
+	ReadHeaderTimeout time.Duration `env:"READ_HEADER_TIMEOUT" default:"5s" usage:"time to read request headers"`
+	ReadTimeout       time.Duration `env:"READ_TIMEOUT" default:"15s" usage:"time to read a whole request"`
+	// WriteTimeout does not apply to data export downloads, which get longer
+	WriteTimeout   time.Duration `env:"WRITE_TIMEOUT" default:"60s" usage:"time to write a response"`
+	IdleTimeout    time.Duration `env:"IDLE_TIMEOUT" default:"120s" usage:"time an idle keep-alive connection is kept open"`
+	MaxHeaderBytes int           `env:"MAX_HEADER_BYTES" default:"65536" usage:"largest request headers accepted"`
+	MaxBodyBytes   int64         `env:"MAX_BODY_BYTES" default:"1048576" usage:"largest request body accepted"`
+
+	DBMaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" default:"25" usage:"most open database connections"`
+	DBMaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" default:"25" usage:"most idle database connections kept"`
+	DBConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" default:"30m" usage:"time after which a database connection is replaced"`
+	DBConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" default:"5m" usage:"time after which an idle database connection is closed"`
+
+	DBURL     Secret `env:"DB_URL" usage:"postgres connection url"`
+	JWTSecret Secret `env:"JWT_SECRET" usage:"secret access tokens are signed with"`
+	PolkaKey  Secret `env:"POLKA_KEY" usage:"API key of the Polka payment webhooks"`
+
+	FilterWordsFile       string `env:"FILTER_WORDS_FILE" usage:"word list of the profanity filter"`
+	SpamConfigFile        string `env:"SPAM_CONFIG_FILE" usage:"spam detection config file"`
+	OIDCConfigFile        string `env:"OIDC_CONFIG_FILE" usage:"external login provider config file"`
+	BreachedPasswordsFile string `env:"BREACHED_PASSWORDS_FILE" usage:"list of breached passwords to refuse"`
+	RateLimitStore        string `env:"RATE_LIMIT_STORE" default:"memory" usage:"memory or postgres"`
+
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header is
+	// believed. Without them clients are known by their connection's address.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" usage:"comma separated IPs or CIDR ranges of reverse proxies whose X-Forwarded-For is trusted"`
+
+	// the password hash parameters keep the auth package's defaults when 0
+	PasswordHashMemoryKiB   uint32 `env:"PASSWORD_HASH_MEMORY_KIB" usage:"memory used to hash a password, in KiB"`
+	PasswordHashIterations  uint32 `env:"PASSWORD_HASH_ITERATIONS" usage:"passes over the memory when hashing a password"`
+	PasswordHashParallelism uint8  `env:"PASSWORD_HASH_PARALLELISM" usage:"threads used to hash a password"`
+
+	// PublicURL defaults to http://localhost and the port
+	PublicURL    string `env:"PUBLIC_URL" usage:"url users reach the server at, for links in emails"`
+	Mailer       string `env:"MAILER" default:"log" usage:"log or smtp"`
+	SMTPAddr     string `env:"SMTP_ADDR" usage:"host:port of the smtp server"`
+	MailFrom     string `env:"MAIL_FROM" usage:"sender of outgoing email"`
+	SMTPUsername string `env:"SMTP_USERNAME" usage:"smtp username"`
+	SMTPPassword Secret `env:"SMTP_PASSWORD" usage:"smtp password"`
+
+	WebAuthnRPID    string   `env:"WEBAUTHN_RP_ID" usage:"domain passkeys are bound to, defaults to the host of the public url"`
+	WebAuthnOrigins []string `env:"WEBAUTHN_ORIGINS" usage:"comma separated origins passkey ceremonies may run in, defaults to the public url"`
+
+	// ExportDir defaults to chirpy-exports in the system temp directory
+	ExportDir string `env:"EXPORT_DIR" usage:"directory data exports are stored in"`
+}
+
+// Load reads the config from the command-line arguments (without the
+// program name), the environment and the files they point to. A .env file in
+// the working directory is read if there is one; the config file is read if
+// -config or CONFIG_FILE names one. With -h or -help the flags are printed to
+// stderr and flag.ErrHelp is returned.
+func Load(args []string) (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("failed to read .env: %w", err)
+	}
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Config{}
+	fields := settings(&cfg)
+	for _, f := range fields {
+		if f.def == "" {
+			continue
+		}
+		if err := f.set(f.def); err != nil {
+			return Config{}, fmt.Errorf("invalid default of %s: %w", f.env, err)
+		}
+	}
+
+	// flags are parsed first to find the config file, and applied last
+	flags := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFile := flags.String("config", "", "YAML or TOML config file")
+	flagValues := map[string]string{}
+	for _, f := range fields {
+		f := f
+		flags.Func(f.flagName(), f.usage, func(s string) error {
+			flagValues[f.env] = s
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		// parse errors are returned, but -h asks for the list of flags
+		if errors.Is(err, flag.ErrHelp) {
+			flags.SetOutput(os.Stderr)
+			flags.Usage()
+		}
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		byKey := map[string]setting{}
+		for _, f := range fields {
+			byKey[f.key()] = f
+		}
+		for key, value := range values {
+			f, ok := byKey[key]
+			if !ok {
+				return Config{}, fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+			if err := f.set(value); err != nil {
+				return Config{}, fmt.Errorf("%s: invalid %s: %w", path, key, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := lookupEnv(f.env); ok && value != "" {
+			if err := f.set(value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", f.env, err)
+			}
+		}
+	}
+	for _, f := range fields {
+		if value, ok := flagValues[f.env]; ok {
+			if err := f.set(value); err != nil {
+				return Config{}, fmt.Errorf("invalid -%s: %w", f.flagName(), err)
+			}
+		}
+	}
+
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = "http://localhost:" + cfg.Port
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the settings work together. Production servers refuse to
+// start without their secrets.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Port == "" {
+		errs = append(errs, errors.New("PORT is required"))
+	}
+	switch c.Platform {
+	case PlatformDev, PlatformProduction:
+	default:
+		errs = append(errs, fmt.Errorf("PLATFORM must be %s or %s, not %q", PlatformDev, PlatformProduction, c.Platform))
+	}
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL is required"))
+	}
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET is required"))
+	}
+	if c.Platform == PlatformProduction {
+		if c.JWTSecret != "" && len(c.JWTSecret) < minSecretLength {
+			errs = append(errs, fmt.Errorf("JWT_SECRET must be at least %d bytes in production", minSecretLength))
+		}
+		if c.PolkaKey == "" {
+			errs = append(errs, errors.New("POLKA_KEY is required in production"))
+		}
+	}
+	durations := map[string]time.Duration{
+		"SHUTDOWN_TIMEOUT":      c.ShutdownTimeout,
+		"READ_HEADER_TIMEOUT":   c.ReadHeaderTimeout,
+		"READ_TIMEOUT":          c.ReadTimeout,
+		"WRITE_TIMEOUT":         c.WriteTimeout,
+		"IDLE_TIMEOUT":          c.IdleTimeout,
+		"DB_CONN_MAX_LIFETIME":  c.DBConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME": c.DBConnMaxIdleTime,
+	}
+	for _, name := range slices.Sorted(maps.Keys(durations)) {
+		if durations[name] <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	if c.ReadHeaderTimeout > c.ReadTimeout {
+		errs = append(errs, errors.New("READ_HEADER_TIMEOUT cannot be longer than READ_TIMEOUT"))
+	}
+	if c.MaxHeaderBytes <= 0 || c.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("MAX_HEADER_BYTES and MAX_BODY_BYTES must be positive"))
+	}
+	if c.DBMaxOpenConns <= 0 || c.DBMaxIdleConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must be positive and DB_MAX_IDLE_CONNS cannot be negative"))
+	} else if c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS cannot be more than DB_MAX_OPEN_CONNS"))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, err := parsePrefix(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+		}
+	}
+	switch c.RateLimitStore {
+	case "memory", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE must be memory or postgres, not %q", c.RateLimitStore))
+	}
+	switch c.Mailer {
+	case "log":
+	case "smtp":
+		if c.SMTPAddr == "" || c.MailFrom == "" {
+			errs = append(errs, errors.New("SMTP_ADDR and MAIL_FROM are required for the smtp mailer"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAILER must be log or smtp, not %q", c.Mailer))
+	}
+	return errors.Join(errs...)
+}
+
+// TrustedProxyPrefixes returns TRUSTED_PROXIES as address ranges, a single
+// address being a range of one. Entries that Validate rejects are left out.
+func (c Config) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if prefix, err := parsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// String lists every setting with secrets redacted, for logging.
+func (c Config) String() string {
+	var b strings.Builder
+	for i, f := range settings(&c) {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%s=%v", f.key(), f.value.Interface())
+	}
+	return b.String()
+}
+
+// helpers ---------------------------------------------------------
+
+// setting is one field of a Config.
+type setting struct {
+	env   string
+	def   string
+	usage string
+	value reflect.Value
+}
+
+func settings(cfg *Config) []setting {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	fields := make([]setting, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fields = append(fields, setting{
+			env:   field.Tag.Get("env"),
+			def:   field.Tag.Get("default"),
+			usage: field.Tag.Get("usage"),
+			value: v.Field(i),
+		})
+	}
+	return fields
+}
+
+func (f setting) key() string {
+	return strings.ToLower(f.env)
+}
+
+func (f setting) flagName() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+func (f setting) set(s string) error {
+	switch f.value.Interface().(type) {
+	case string, Secret:
+		f.value.SetString(s)
+	case []string:
+		values := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(values))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case int, int64:
+		n, err := strconv.ParseInt(s, 10, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case uint8, uint32, uint64:
+		n, err := strconv.ParseUint(s, 10, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
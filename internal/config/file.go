@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFile reads the settings in a config file. The format comes from the
+// extension: .yaml or .yml for YAML, .toml for TOML. Only the subset of each
+// that a flat list of settings needs is understood: one "key: value" or
+// "key = value" per line, with scalar values that may be quoted, lists written
+// as comma separated strings, and # comments.
+func readFile(path string) (map[string]string, error) {
+	var sep string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		sep = ":"
+	case ".toml":
+		sep = "="
+	default:
+		return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key%s value", path, n, sep)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t[]{}\"'") {
+			return nil, fmt.Errorf("%s:%d: invalid key %q", path, n, key)
+		}
+		value, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is set twice", path, n, key)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// parseValue unquotes a value and drops a trailing comment.
+func parseValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		// a double quoted string ends at the first unescaped quote
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+			} else if s[end] == '"' {
+				break
+			}
+		}
+		if end >= len(s) {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		if err := checkTrailing(s[end+1:]); err != nil {
+			return "", err
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		if err := checkTrailing(s[end+2:]); err != nil {
+			return "", err
+		}
+		return s[1 : end+1], nil
+	case strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{"):
+		return "", fmt.Errorf("lists and tables are not supported, write lists as a comma separated string")
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+func checkTrailing(s string) error {
+	s = strings.TrimSpace(s)
+	if s != "" && !strings.HasPrefix(s, "#") {
+		return fmt.Errorf("unexpected %q after string", s)
+	}
+	return nil
+}
@@ -7,23 +7,71 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+const countDuplicateChirpAuthors = `-- name: CountDuplicateChirpAuthors :one
+SELECT COUNT(DISTINCT user_id) FROM chirps
+WHERE md5(lower(body)) = md5(lower($1::text))
+  AND user_id <> $2
+  AND created_at > $3
 `
 
-type CreateChirpParams struct {
+type CountDuplicateChirpAuthorsParams struct {
 	Body   string
 	UserID uuid.UUID
+	Since  time.Time
+}
+
+func (q *Queries) CountDuplicateChirpAuthors(ctx context.Context, arg CountDuplicateChirpAuthorsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countDuplicateChirpAuthors, arg.Body, arg.UserID, arg.Since)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRecentChirpsByAuthor = `-- name: CountRecentChirpsByAuthor :one
+SELECT COUNT(*) FROM chirps WHERE user_id = $1 AND created_at > $2
+`
+
+type CountRecentChirpsByAuthorParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) CountRecentChirpsByAuthor(ctx context.Context, arg CountRecentChirpsByAuthorParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countRecentChirpsByAuthor, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createChirp = `-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held
+`
+
+type CreateChirpParams struct {
+	Body        string
+	UserID      uuid.UUID
+	Visibility  string
+	SpoilerText string
+	Sensitive   bool
+	Held        bool
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.Visibility,
+		arg.SpoilerText,
+		arg.Sensitive,
+		arg.Held,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,10 +79,30 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Visibility,
+		&i.SpoilerText,
+		&i.Sensitive,
+		&i.Held,
 	)
 	return i, err
 }
 
+const createChirpMention = `-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (chirp_id, user_id) DO NOTHING
+`
+
+type CreateChirpMentionParams struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+func (q *Queries) CreateChirpMention(ctx context.Context, arg CreateChirpMentionParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpMention, arg.ChirpID, arg.UserID)
+	return err
+}
+
 const deleteChirp = `-- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1
 `
@@ -45,7 +113,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -57,16 +125,29 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Visibility,
+		&i.SpoilerText,
+		&i.Sensitive,
+		&i.Held,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
+SELECT id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held FROM chirps
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpsByAuthorParams struct {
+	UserID uuid.UUID
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) GetChirpsByAuthor(ctx context.Context, arg GetChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, arg.UserID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -80,6 +161,10 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Visibility,
+			&i.SpoilerText,
+			&i.Sensitive,
+			&i.Held,
 		); err != nil {
 			return nil, err
 		}
@@ -93,3 +178,121 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const getVisibleChirpById = `-- name: GetVisibleChirpById :one
+SELECT id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held FROM chirps
+WHERE id = $1
+  AND chirp_visible_to(chirps, $2::uuid)
+`
+
+type GetVisibleChirpByIdParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetVisibleChirpById(ctx context.Context, arg GetVisibleChirpByIdParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirpById, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.SpoilerText,
+		&i.Sensitive,
+		&i.Held,
+	)
+	return i, err
+}
+
+const getVisibleChirps = `-- name: GetVisibleChirps :many
+SELECT id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held FROM chirps
+WHERE chirp_visible_to(chirps, $1::uuid)
+`
+
+func (q *Queries) GetVisibleChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getVisibleChirps, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.SpoilerText,
+			&i.Sensitive,
+			&i.Held,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setChirpHeld = `-- name: SetChirpHeld :one
+UPDATE chirps SET held = $2, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held
+`
+
+type SetChirpHeldParams struct {
+	ID   uuid.UUID
+	Held bool
+}
+
+func (q *Queries) SetChirpHeld(ctx context.Context, arg SetChirpHeldParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, setChirpHeld, arg.ID, arg.Held)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.SpoilerText,
+		&i.Sensitive,
+		&i.Held,
+	)
+	return i, err
+}
+
+const setChirpSensitive = `-- name: SetChirpSensitive :one
+UPDATE chirps SET sensitive = $2, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held
+`
+
+type SetChirpSensitiveParams struct {
+	ID        uuid.UUID
+	Sensitive bool
+}
+
+func (q *Queries) SetChirpSensitive(ctx context.Context, arg SetChirpSensitiveParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, setChirpSensitive, arg.ID, arg.Sensitive)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.SpoilerText,
+		&i.Sensitive,
+		&i.Held,
+	)
+	return i, err
+}
@@ -6,17 +6,246 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AccountRestoreToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type AccountStateTransition struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FromState string
+	ToState   string
+	Reason    string
+	ExpiresAt sql.NullTime
+	ActorID   uuid.NullUUID
+	CreatedAt time.Time
+}
+
+type AuditEvent struct {
+	ID        uuid.UUID
+	Action    string
+	ActorID   uuid.NullUUID
+	TargetID  uuid.NullUUID
+	Ip        string
+	UserAgent string
+	Metadata  json.RawMessage
+	CreatedAt time.Time
+}
+
+type Bookmark struct {
+	UserID     uuid.UUID
+	ChirpID    uuid.UUID
+	Collection string
+	CreatedAt  time.Time
+}
+
 type Chirp struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	Visibility  string
+	SpoilerText string
+	Sensitive   bool
+	Held        bool
+}
+
+type ChirpFlag struct {
 	ID        uuid.UUID
+	ChirpID   uuid.UUID
+	Source    string
+	Reason    string
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+}
+
+type ChirpMention struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	Word      string
+	Action    string
+	CreatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserID              uuid.UUID
+	Scopes              []string
+	RedirectUri         string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ExpiresAt           time.Time
+	UsedAt              sql.NullTime
+	GrantID             uuid.NullUUID
+}
+
+type OauthClient struct {
+	ID           string
+	SecretHash   sql.NullString
+	Name         string
+	RedirectUris []string
+	Scopes       []string
+	OwnerID      uuid.UUID
+	CreatedAt    time.Time
+}
+
+type OauthGrant struct {
+	ID        uuid.UUID
+	ClientID  string
 	UserID    uuid.UUID
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	CreatedAt  time.Time
+}
+
+type PinnedChirp struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Status      string
+	FilePath    string
+	SizeBytes   int64
+	CreatedAt   time.Time
+	StartedAt   sql.NullTime
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+type EmailChangeToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	NewEmail  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type ExternalIdentity struct {
+	Provider    string
+	Subject     string
+	UserID      uuid.UUID
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+type LoginThrottle struct {
+	Key               string
+	Failures          int32
+	LastFailureAt     time.Time
+	PreviousFailureAt sql.NullTime
+}
+
+type MagicLinkToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type Passkey struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	Transports   []string
+	Name         string
+	CreatedAt    time.Time
+	LastUsedAt   sql.NullTime
+}
+
+type PasskeyChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.NullUUID
+	Purpose   string
+	Challenge string
+	ExpiresAt time.Time
+}
+
+type ModerationAction struct {
+	ID             uuid.UUID
+	ReportID       uuid.UUID
+	ModeratorID    uuid.NullUUID
+	TargetUserID   uuid.NullUUID
+	ChirpID        uuid.NullUUID
+	Action         string
+	Note           string
+	SuspendedUntil sql.NullTime
+	CreatedAt      time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Kind      string
+	Message   string
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+type Poll struct {
+	ID        uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type PollOption struct {
+	ID       uuid.UUID
+	PollID   uuid.UUID
+	Position int32
+	Text     string
+}
+
+type PollVote struct {
+	PollID    uuid.UUID
+	OptionID  uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -26,13 +255,69 @@ type RefreshToken struct {
 	UserID    uuid.UUID
 	ExpiresAt sql.NullTime
 	RevokedAt sql.NullTime
+	GrantID   uuid.NullUUID
 }
 
-type User struct {
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
+type Report struct {
 	ID             uuid.UUID
+	ReporterID     uuid.NullUUID
+	ReportedUserID uuid.NullUUID
+	ChirpID        uuid.NullUUID
+	ChirpBody      string
+	Category       string
+	Details        string
+	Status         string
+	ClaimedBy      uuid.NullUUID
+	ClaimedAt      sql.NullTime
+	ClosedBy       uuid.NullUUID
+	ClosedAt       sql.NullTime
+	ResolutionNote string
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+}
+
+type SpamScore struct {
+	ID            uuid.UUID
+	ChirpID       uuid.NullUUID
+	UserID        uuid.UUID
+	Body          string
+	Score         float64
+	Verdict       string
+	Signals       json.RawMessage
+	ReviewOutcome string
+	ReviewedBy    uuid.NullUUID
+	ReviewedAt    sql.NullTime
+	CreatedAt     time.Time
+}
+
+type User struct {
+	ID                    uuid.UUID
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	Email                 string
+	HashedPassword        string
+	IsChirpyRed           bool
+	Role                  string
+	AccountState          string
+	StateExpiresAt        sql.NullTime
+	PasswordResetRequired bool
+	PostingCooldownUntil  sql.NullTime
+	HasPassword           bool
+	PasskeyRequired       bool
+	DeleteAfter           sql.NullTime
+	TokensValidAfter      sql.NullTime
+}
+
+type UserPreference struct {
+	UserID             uuid.UUID
+	AlwaysExpand       bool
+	HideSensitiveMedia bool
+	UpdatedAt          time.Time
 }
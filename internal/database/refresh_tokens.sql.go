@@ -14,19 +14,25 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, grant_id)
+VALUES ($1, NOW(), NOW(), $2, $3, $4)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, grant_id
 `
 
 type CreateRefreshTokenParams struct {
 	Token     string
 	UserID    uuid.UUID
 	ExpiresAt sql.NullTime
+	GrantID   uuid.NullUUID
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.GrantID,
+	)
 	var i RefreshToken
 	err := row.Scan(
 		&i.Token,
@@ -35,12 +41,50 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.GrantID,
 	)
 	return i, err
 }
 
+const getActiveRefreshTokens = `-- name: GetActiveRefreshTokens :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, grant_id FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetActiveRefreshTokens(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveRefreshTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.GrantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getToken = `-- name: GetToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, grant_id FROM refresh_tokens WHERE token = $1
 `
 
 func (q *Queries) GetToken(ctx context.Context, token string) (RefreshToken, error) {
@@ -53,15 +97,27 @@ func (q *Queries) GetToken(ctx context.Context, token string) (RefreshToken, err
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.GrantID,
 	)
 	return i, err
 }
 
+const revokeUserTokens = `-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserTokens, userID)
+	return err
+}
+
 const updateToken = `-- name: UpdateToken :one
 UPDATE refresh_tokens 
 SET revoked_at = $1, updated_at = $2
 WHERE token = $3 
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, grant_id
 `
 
 type UpdateTokenParams struct {
@@ -80,6 +136,7 @@ func (q *Queries) UpdateToken(ctx context.Context, arg UpdateTokenParams) (Refre
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.GrantID,
 	)
 	return i, err
 }
@@ -7,14 +7,60 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*) FROM users
+`
+
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createFederatedUser = `-- name: CreateFederatedUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, has_password)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, FALSE)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after
+`
+
+type CreateFederatedUserParams struct {
+	Email          string
+	HashedPassword string
+}
+
+func (q *Queries) CreateFederatedUser(ctx context.Context, arg CreateFederatedUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createFederatedUser, arg.Email, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after
 `
 
 type CreateUserParams struct {
@@ -32,10 +78,28 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 DELETE FROM users
 `
@@ -55,7 +119,7 @@ func (q *Queries) DowngradeUserFromChirpyRed(ctx context.Context, id uuid.UUID)
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -68,22 +132,336 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const getUserByIDForUpdate = `-- name: GetUserByIDForUpdate :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after FROM users WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+const getUsersDueForDeletion = `-- name: GetUsersDueForDeletion :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after FROM users WHERE delete_after <= NOW() ORDER BY delete_after LIMIT $1
+`
+
+func (q *Queries) GetUsersDueForDeletion(ctx context.Context, limit int32) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersDueForDeletion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Role,
+			&i.AccountState,
+			&i.StateExpiresAt,
+			&i.PasswordResetRequired,
+			&i.PostingCooldownUntil,
+			&i.HasPassword,
+			&i.PasskeyRequired,
+			&i.DeleteAfter,
+			&i.TokensValidAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const requirePasswordReset = `-- name: RequirePasswordReset :exec
+UPDATE users SET password_reset_required = TRUE, updated_at = NOW() WHERE id = $1
 `
 
-type UpdateUserParams struct {
+func (q *Queries) RequirePasswordReset(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, requirePasswordReset, id)
+	return err
+}
+
+const revokeAccessTokens = `-- name: RevokeAccessTokens :exec
+UPDATE users SET tokens_valid_after = NOW(), updated_at = NOW() WHERE id = $1
+`
+
+func (q *Queries) RevokeAccessTokens(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAccessTokens, id)
+	return err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after FROM users
+WHERE email ILIKE '%' || $1::text || '%'
+ORDER BY email
+LIMIT $2 OFFSET $3
+`
+
+type SearchUsersParams struct {
+	Query      string
+	PageLimit  int32
+	PageOffset int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Query, arg.PageLimit, arg.PageOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Role,
+			&i.AccountState,
+			&i.StateExpiresAt,
+			&i.PasswordResetRequired,
+			&i.PostingCooldownUntil,
+			&i.HasPassword,
+			&i.PasskeyRequired,
+			&i.DeleteAfter,
+			&i.TokensValidAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setAccountState = `-- name: SetAccountState :one
+UPDATE users SET account_state = $2, state_expires_at = $3, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after
+`
+
+type SetAccountStateParams struct {
+	ID             uuid.UUID
+	AccountState   string
+	StateExpiresAt sql.NullTime
+}
+
+func (q *Queries) SetAccountState(ctx context.Context, arg SetAccountStateParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setAccountState, arg.ID, arg.AccountState, arg.StateExpiresAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const setDeleteAfter = `-- name: SetDeleteAfter :exec
+UPDATE users SET delete_after = $2, updated_at = NOW() WHERE id = $1
+`
+
+type SetDeleteAfterParams struct {
+	ID          uuid.UUID
+	DeleteAfter sql.NullTime
+}
+
+func (q *Queries) SetDeleteAfter(ctx context.Context, arg SetDeleteAfterParams) error {
+	_, err := q.db.ExecContext(ctx, setDeleteAfter, arg.ID, arg.DeleteAfter)
+	return err
+}
+
+const setPasskeyRequired = `-- name: SetPasskeyRequired :exec
+UPDATE users SET passkey_required = $2, updated_at = NOW() WHERE id = $1
+`
+
+type SetPasskeyRequiredParams struct {
+	ID              uuid.UUID
+	PasskeyRequired bool
+}
+
+func (q *Queries) SetPasskeyRequired(ctx context.Context, arg SetPasskeyRequiredParams) error {
+	_, err := q.db.ExecContext(ctx, setPasskeyRequired, arg.ID, arg.PasskeyRequired)
+	return err
+}
+
+const setPostingCooldown = `-- name: SetPostingCooldown :exec
+UPDATE users SET posting_cooldown_until = $2, updated_at = NOW() WHERE id = $1
+`
+
+type SetPostingCooldownParams struct {
+	ID                   uuid.UUID
+	PostingCooldownUntil sql.NullTime
+}
+
+func (q *Queries) SetPostingCooldown(ctx context.Context, arg SetPostingCooldownParams) error {
+	_, err := q.db.ExecContext(ctx, setPostingCooldown, arg.ID, arg.PostingCooldownUntil)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const updateEmail = `-- name: UpdateEmail :one
+UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after
+`
+
+type UpdateEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) UpdateEmail(ctx context.Context, arg UpdateEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
+	)
+	return i, err
+}
+
+const updatePassword = `-- name: UpdatePassword :one
+UPDATE users SET hashed_password = $2, password_reset_required = FALSE, has_password = TRUE, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, account_state, state_expires_at, password_reset_required, posting_cooldown_until, has_password, passkey_required, delete_after, tokens_valid_after
+`
+
+type UpdatePasswordParams struct {
 	ID             uuid.UUID
-	Email          string
 	HashedPassword string
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updatePassword, arg.ID, arg.HashedPassword)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -92,10 +470,33 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.AccountState,
+		&i.StateExpiresAt,
+		&i.PasswordResetRequired,
+		&i.PostingCooldownUntil,
+		&i.HasPassword,
+		&i.PasskeyRequired,
+		&i.DeleteAfter,
+		&i.TokensValidAfter,
 	)
 	return i, err
 }
 
+const updatePasswordHash = `-- name: UpdatePasswordHash :exec
+UPDATE users SET hashed_password = $2 WHERE id = $1
+`
+
+type UpdatePasswordHashParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, updatePasswordHash, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :exec
 UPDATE users SET is_chirpy_red = TRUE WHERE id = $1
 `
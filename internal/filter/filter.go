@@ -0,0 +1,431 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Action string
+
+const (
+	// ActionMask replaces the word with asterisks
+	ActionMask Action = "mask"
+	// ActionReject refuses the whole text
+	ActionReject Action = "reject"
+	// ActionFlag accepts the text but marks it for moderator review
+	ActionFlag Action = "flag"
+)
+
+const mask = "****"
+
+type Rule struct {
+	Word   string
+	Action Action
+}
+
+type Match struct {
+	Word   string
+	Action Action
+}
+
+type Result struct {
+	// Text is the input with every masked word replaced
+	Text     string
+	Rejected bool
+	Flagged  bool
+	Matches  []Match
+}
+
+// Filter matches words after normalizing case, Unicode look-alikes,
+// diacritics and leetspeak, so "Kerfuffle!", "K3RFUFFLE" and "kérfuffle"
+// all match the rule "kerfuffle". Stretched words like "kerrrfuuuffle" match
+// too, but only where letters are repeated more than in the rule, so "as"
+// does not match "ass".
+type Filter struct {
+	// rules are keyed by their normalized word with runs of a letter
+	// collapsed to one
+	rules map[string][]entry
+}
+
+type entry struct {
+	rule Rule
+	// runs are the lengths of the runs of letters in the normalized word
+	runs []int
+}
+
+// DefaultRules are used when no word list is configured.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "sharbert", Action: ActionMask},
+		{Word: "fornax", Action: ActionMask},
+	}
+}
+
+func New(rules []Rule) *Filter {
+	f := &Filter{rules: map[string][]entry{}}
+	for _, rule := range rules {
+		for _, form := range variants(rule.Word) {
+			if form == "" {
+				continue
+			}
+			f.add(rule, form)
+		}
+	}
+	return f
+}
+
+func (f *Filter) add(rule Rule, form string) {
+	key, runs := collapse(form)
+	entries := f.rules[key]
+	for i, e := range entries {
+		if slices.Equal(e.runs, runs) {
+			// the strictest action wins when two rules normalize to the same word
+			if severity(rule.Action) > severity(e.rule.Action) {
+				entries[i].rule = rule
+			}
+			return
+		}
+	}
+	f.rules[key] = append(entries, entry{rule: rule, runs: runs})
+}
+
+// match finds the strictest rule a word matches. A word matches a rule when
+// it normalizes to the same letters, each repeated at least as often.
+func (f *Filter) match(word string) (Rule, bool) {
+	var found Rule
+	ok := false
+	for _, form := range variants(word) {
+		key, runs := collapse(form)
+		for _, e := range f.rules[key] {
+			if !longerRuns(runs, e.runs) {
+				continue
+			}
+			if !ok || severity(e.rule.Action) > severity(found.Action) {
+				found, ok = e.rule, true
+			}
+		}
+	}
+	return found, ok
+}
+
+// ParseAction validates an action name, defaulting to mask.
+func ParseAction(s string) (Action, error) {
+	switch Action(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ActionMask:
+		return ActionMask, nil
+	case ActionReject:
+		return ActionReject, nil
+	case ActionFlag:
+		return ActionFlag, nil
+	}
+	return "", fmt.Errorf("unknown filter action %q", s)
+}
+
+// LoadFile reads a word list with one rule per line: a word optionally followed
+// by an action (mask, reject or flag). Blank lines and lines starting with # are ignored.
+func LoadFile(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+func Parse(r io.Reader) ([]Rule, error) {
+	rules := []Rule{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a word and an optional action", lineNum)
+		}
+		action := ActionMask
+		if len(fields) == 2 {
+			var err error
+			action, err = ParseAction(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+		}
+		rules = append(rules, Rule{Word: fields[0], Action: action})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Apply checks every word of text against the rules.
+func (f *Filter) Apply(text string) Result {
+	result := Result{}
+	var b strings.Builder
+
+	for _, tok := range tokenize(text) {
+		if !tok.word {
+			b.WriteString(tok.text)
+			continue
+		}
+
+		rule, ok := f.match(tok.text)
+		if !ok {
+			b.WriteString(tok.text)
+			continue
+		}
+
+		result.Matches = append(result.Matches, Match{Word: rule.Word, Action: rule.Action})
+		switch rule.Action {
+		case ActionReject:
+			result.Rejected = true
+			b.WriteString(tok.text)
+		case ActionFlag:
+			result.Flagged = true
+			b.WriteString(tok.text)
+		default:
+			b.WriteString(mask)
+		}
+	}
+
+	result.Text = b.String()
+	return result
+}
+
+// Length counts characters rather than bytes.
+func Length(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// Normalize maps a word to the form rules are matched on: lower case, without
+// diacritics or zero-width characters, and with leetspeak and full-width
+// characters replaced by their plain letters. A '1' reads as an i here; the
+// filter also tries it as an l.
+func Normalize(word string) string {
+	var b strings.Builder
+	for _, r := range word {
+		if readings := fold(r); isLetter(readings[0]) && !isIgnorable(r) {
+			b.WriteRune(readings[0])
+		}
+	}
+	return b.String()
+}
+
+// maxVariants bounds the readings of a word with many ambiguous characters.
+// Characters past the bound only get their first reading.
+const maxVariants = 16
+
+// variants returns the normalized forms of a word, one for each reading of
+// its ambiguous characters.
+func variants(word string) []string {
+	forms := [][]rune{{}}
+	for _, r := range word {
+		if isIgnorable(r) {
+			continue
+		}
+		readings := fold(r)
+		if !isLetter(readings[0]) {
+			continue
+		}
+		if len(readings) == 1 || len(forms)*len(readings) > maxVariants {
+			for i := range forms {
+				forms[i] = append(forms[i], readings[0])
+			}
+			continue
+		}
+		next := make([][]rune, 0, len(forms)*len(readings))
+		for _, form := range forms {
+			for _, reading := range readings {
+				next = append(next, append(slices.Clip(form), reading))
+			}
+		}
+		forms = next
+	}
+
+	out := make([]string, len(forms))
+	for i, form := range forms {
+		out[i] = string(form)
+	}
+	return out
+}
+
+// collapse replaces each run of a letter with one, so "kerfffuffle" becomes
+// "kerfufle", and returns the length of each run.
+func collapse(form string) (string, []int) {
+	var b strings.Builder
+	runs := []int{}
+	var last rune
+	for i, r := range form {
+		if i > 0 && r == last {
+			runs[len(runs)-1]++
+			continue
+		}
+		last = r
+		b.WriteRune(r)
+		runs = append(runs, 1)
+	}
+	return b.String(), runs
+}
+
+// longerRuns reports whether every run of a word is at least as long as the
+// same run of a rule. Both must have the same collapsed form.
+func longerRuns(word, rule []int) bool {
+	if len(word) != len(rule) {
+		return false
+	}
+	for i := range word {
+		if word[i] < rule[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type token struct {
+	text string
+	word bool
+}
+
+// tokenize splits text into alternating word and separator tokens. Leetspeak
+// symbols are part of a word when more of the word follows them, so "sh@rbert"
+// is one word but "fornax!" is the word "fornax" followed by "!".
+func tokenize(text string) []token {
+	type pos struct {
+		offset int
+		r      rune
+	}
+	runes := []pos{}
+	for i, r := range text {
+		runes = append(runes, pos{offset: i, r: r})
+	}
+
+	isBase := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || isIgnorable(r)
+	}
+	isWord := make([]bool, len(runes))
+	for i := len(runes) - 1; i >= 0; i-- {
+		switch {
+		case isBase(runes[i].r):
+			isWord[i] = true
+		case isLeetSymbol(runes[i].r) && i+1 < len(runes):
+			isWord[i] = isWord[i+1]
+		}
+	}
+
+	tokens := []token{}
+	for i := range runes {
+		if i > 0 && isWord[i] == isWord[i-1] {
+			continue
+		}
+		end := len(text)
+		for j := i + 1; j < len(runes); j++ {
+			if isWord[j] != isWord[i] {
+				end = runes[j].offset
+				break
+			}
+		}
+		tokens = append(tokens, token{text: text[runes[i].offset:end], word: isWord[i]})
+	}
+	return tokens
+}
+
+func severity(action Action) int {
+	switch action {
+	case ActionReject:
+		return 2
+	case ActionFlag:
+		return 1
+	}
+	return 0
+}
+
+func isLeetSymbol(r rune) bool {
+	switch r {
+	case '@', '$', '!', '|', '+':
+		return true
+	}
+	return false
+}
+
+// isIgnorable reports invisible characters used to split up words.
+func isIgnorable(r rune) bool {
+	switch r {
+	case '\u00ad', '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+	return unicode.Is(unicode.Mn, r)
+}
+
+// leet maps symbols to the letters they stand for, the likeliest first.
+var leet = map[rune][]rune{
+	'0': {'o'},
+	'1': {'i', 'l'},
+	'3': {'e'},
+	'4': {'a'},
+	'5': {'s'},
+	'7': {'t'},
+	'8': {'b'},
+	'9': {'g'},
+	'@': {'a'},
+	'$': {'s'},
+	'!': {'i'},
+	'|': {'l'},
+	'+': {'t'},
+}
+
+var diacritics = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ă': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'ĉ': 'c', 'ċ': 'c', 'č': 'c',
+	'ď': 'd', 'đ': 'd',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ĕ': 'e', 'ė': 'e', 'ę': 'e', 'ě': 'e',
+	'ĝ': 'g', 'ğ': 'g', 'ġ': 'g', 'ģ': 'g',
+	'ĥ': 'h', 'ħ': 'h',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ĩ': 'i', 'ī': 'i', 'ĭ': 'i', 'į': 'i', 'ı': 'i',
+	'ĵ': 'j',
+	'ķ': 'k',
+	'ĺ': 'l', 'ļ': 'l', 'ľ': 'l', 'ŀ': 'l', 'ł': 'l',
+	'ñ': 'n', 'ń': 'n', 'ņ': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o', 'ŏ': 'o', 'ő': 'o',
+	'ŕ': 'r', 'ŗ': 'r', 'ř': 'r',
+	'ś': 's', 'ŝ': 's', 'ş': 's', 'š': 's', 'ß': 's',
+	'ţ': 't', 'ť': 't', 'ŧ': 't',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ũ': 'u', 'ū': 'u', 'ŭ': 'u', 'ů': 'u', 'ű': 'u', 'ų': 'u',
+	'ŵ': 'w',
+	'ý': 'y', 'ÿ': 'y', 'ŷ': 'y',
+	'ź': 'z', 'ż': 'z', 'ž': 'z',
+	// common Cyrillic and Greek look-alikes
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'к': 'k', 'м': 'm', 'т': 't', 'н': 'h',
+	'α': 'a', 'ο': 'o', 'ρ': 'p', 'κ': 'k', 'ν': 'v', 'τ': 't',
+}
+
+// fold returns the plain letters a character can be read as.
+func fold(r rune) []rune {
+	// full-width forms, e.g. "ＦＯＲＮＡＸ"
+	if r >= '\uff01' && r <= '\uff5e' {
+		r -= 0xfee0
+	}
+	r = unicode.ToLower(r)
+	if mapped, ok := leet[r]; ok {
+		return mapped
+	}
+	if mapped, ok := diacritics[r]; ok {
+		return []rune{mapped}
+	}
+	return []rune{r}
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
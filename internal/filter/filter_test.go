@@ -0,0 +1,170 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	f := New([]Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "sharbert", Action: ActionMask},
+		{Word: "fornax", Action: ActionMask},
+		{Word: "blorp", Action: ActionReject},
+		{Word: "zorp", Action: ActionFlag},
+		{Word: "ass", Action: ActionReject},
+		{Word: "hell", Action: ActionMask},
+		{Word: "all", Action: ActionFlag},
+	})
+
+	tests := []struct {
+		name         string
+		text         string
+		wantText     string
+		wantRejected bool
+		wantFlagged  bool
+	}{
+		{
+			name:     "Clean text",
+			text:     "I had something interesting for breakfast",
+			wantText: "I had something interesting for breakfast",
+		},
+		{
+			name:     "Whole word",
+			text:     "I really need a kerfuffle to go to bed sooner",
+			wantText: "I really need a **** to go to bed sooner",
+		},
+		{
+			name:     "Trailing punctuation",
+			text:     "Kerfuffle! What a fornax, honestly.",
+			wantText: "****! What a ****, honestly.",
+		},
+		{
+			name:     "Leetspeak",
+			text:     "what a sh@rb3rt and a f0rn4x",
+			wantText: "what a **** and a ****",
+		},
+		{
+			name:     "Full-width and diacritics",
+			text:     "ＦＯＲＮＡＸ and kérfüffle",
+			wantText: "**** and ****",
+		},
+		{
+			name:     "Zero-width characters",
+			text:     "for\u200bnax",
+			wantText: "****",
+		},
+		{
+			name:     "Repeated letters",
+			text:     "kerrrfuuuffle",
+			wantText: "****",
+		},
+		{
+			name:     "Shorter runs are not matched",
+			text:     "as good as it gets, said hel",
+			wantText: "as good as it gets, said hel",
+		},
+		{
+			name:     "Stretched short words",
+			text:     "what the hellllll",
+			wantText: "what the ****",
+		},
+		{
+			name:         "Stretched reject",
+			text:         "a55s",
+			wantText:     "a55s",
+			wantRejected: true,
+		},
+		{
+			name:     "One as i or l",
+			text:     "he11 and k3rfuff1e",
+			wantText: "**** and ****",
+		},
+		{
+			name:     "One as l without a repeated run",
+			text:     "a1 is fine",
+			wantText: "a1 is fine",
+		},
+		{
+			name:     "Substrings are not matched",
+			text:     "fornaxes are not a word",
+			wantText: "fornaxes are not a word",
+		},
+		{
+			name:         "Reject",
+			text:         "this is blorp.",
+			wantText:     "this is blorp.",
+			wantRejected: true,
+		},
+		{
+			name:        "Flag",
+			text:        "zorp and kerfuffle",
+			wantText:    "zorp and ****",
+			wantFlagged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.Apply(tt.text)
+			if got.Text != tt.wantText {
+				t.Errorf("Apply() text = %q, want %q", got.Text, tt.wantText)
+			}
+			if got.Rejected != tt.wantRejected {
+				t.Errorf("Apply() rejected = %v, want %v", got.Rejected, tt.wantRejected)
+			}
+			if got.Flagged != tt.wantFlagged {
+				t.Errorf("Apply() flagged = %v, want %v", got.Flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := `
+# word list
+kerfuffle
+blorp reject
+zorp FLAG
+`
+	rules, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "blorp", Action: ActionReject},
+		{Word: "zorp", Action: ActionFlag},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("Parse() got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("Parse() rule %d = %v, want %v", i, rules[i], want[i])
+		}
+	}
+
+	if _, err := Parse(strings.NewReader("kerfuffle explode")); err == nil {
+		t.Errorf("Parse() expected error for unknown action")
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "hello", want: 5},
+		{text: "héllo", want: 5},
+		{text: "🐦🐦🐦", want: 3},
+		{text: "日本語", want: 3},
+	}
+
+	for _, tt := range tests {
+		if got := Length(tt.text); got != tt.want {
+			t.Errorf("Length(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
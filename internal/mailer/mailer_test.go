@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one message and sends what it received on the
+// returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		var transcript strings.Builder
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "MAIL", "RCPT":
+				transcript.WriteString(line + "\n")
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := io.ReadAll(tp.DotReader())
+				transcript.Write(data)
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	m, err := NewSMTPMailer(addr, "Chirpy <noreply@chirpy.example.com>", "", "")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.Send(ctx, Message{To: "user@example.com", Subject: "Log in to Chirpy", Text: "Hi,\n.\nclick here"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := <-received
+	for _, want := range []string{
+		"MAIL FROM:<noreply@chirpy.example.com>",
+		"RCPT TO:<user@example.com>",
+		"From: Chirpy <noreply@chirpy.example.com>",
+		"To: user@example.com",
+		"Subject: Log in to Chirpy",
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message is missing %q:\n%s", want, got)
+		}
+	}
+
+	_, body, _ := strings.Cut(got, "\n\n")
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	// the server's DotReader turns line breaks into \n
+	if strings.TrimSuffix(string(decoded), "\n") != "Hi,\n.\nclick here" {
+		t.Errorf("body = %q, want the text with a line holding only a dot intact", decoded)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{"valid", Message{To: "user@example.com", Subject: "Hello", Text: "hi"}, false},
+		{"non-ascii subject", Message{To: "user@example.com", Subject: "Grüße", Text: "hi"}, false},
+		{"header injection in subject", Message{To: "user@example.com", Subject: "Hello\r\nBcc: victim@example.com", Text: "hi"}, true},
+		{"header injection in recipient", Message{To: "user@example.com\nBcc: victim@example.com", Subject: "Hello"}, true},
+		{"no recipient", Message{Subject: "Hello"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := buildMessage("noreply@chirpy.example.com", tt.msg, date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(string(data)))).ReadMIMEHeader()
+			if err != nil {
+				t.Fatalf("failed to parse message: %v", err)
+			}
+			if len(header.Values("Subject")) != 1 || header.Get("Date") != date.Format(time.RFC1123Z) {
+				t.Errorf("buildMessage() headers = %v", header)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubProvider is a minimal OpenID Connect provider. It hands out one
+// authorization code, whose ID token carries the claims in the claims field.
+type stubProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu            sync.Mutex
+	keys          map[string]*rsa.PrivateKey
+	signingKey    string
+	code          string
+	codeChallenge string
+	claims        jwt.MapClaims
+	jwksFetches   int
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	s := &stubProvider{t: t, keys: map[string]*rsa.PrivateKey{}}
+	s.addKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.server.URL,
+			"authorization_endpoint": s.server.URL + "/authorize",
+			"token_endpoint":         s.server.URL + "/token",
+			"jwks_uri":               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.jwksFetches++
+		keys := []map[string]string{}
+		for kid, key := range s.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != s.code || base64.RawURLEncoding.EncodeToString(sum[:]) != s.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "chirpy" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": s.sign(s.signingKey, s.claims), "token_type": "Bearer"})
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *stubProvider) addKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		s.t.Fatalf("failed to generate key: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = key
+	s.signingKey = kid
+}
+
+func (s *stubProvider) sign(kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(s.keys[kid])
+	if err != nil {
+		s.t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func (s *stubProvider) validClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            s.server.URL,
+		"sub":            "user-123",
+		"aud":            "chirpy",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+}
+
+func (s *stubProvider) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:         "stub",
+		Issuer:       s.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "secret",
+		RedirectURL:  "https://chirpy.example.com/callback",
+	}, s.server.Client())
+}
+
+func TestExchange(t *testing.T) {
+	stub := newStubProvider(t)
+	p := stub.provider()
+	ctx := context.Background()
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE() error = %v", err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != "chirpy" || q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" ||
+		q.Get("code_challenge") != challenge || q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		t.Fatalf("AuthCodeURL() = %s, missing parameters", authURL)
+	}
+
+	stub.code = "code-1"
+	stub.codeChallenge = challenge
+	stub.claims = stub.validClaims("nonce-1")
+
+	token, err := p.Exchange(ctx, "code-1", verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if token.Subject != "user-123" || token.Email != "user@example.com" || !token.EmailVerified {
+		t.Errorf("Exchange() = %+v, want the stub's claims", token)
+	}
+
+	if _, err := p.Exchange(ctx, "code-1", "wrong-verifier-wrong-verifier-wrong-verifier", "nonce-1"); err == nil {
+		t.Errorf("Exchange() with the wrong code verifier succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	stub := newStubProvider(t)
+	p := stub.provider()
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, stub.validClaims("n"))
+	forged.Header["kid"] = "key-1"
+	forgedToken, _ := forged.SignedString(other)
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, stub.validClaims("n")).SignedString([]byte("secret"))
+
+	with := func(key string, value any) string {
+		claims := stub.validClaims("n")
+		claims[key] = value
+		return stub.sign("key-1", claims)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", stub.sign("key-1", stub.validClaims("n")), false},
+		{"string email_verified", with("email_verified", "true"), false},
+		{"wrong nonce", stub.sign("key-1", stub.validClaims("other")), true},
+		{"wrong audience", with("aud", "another-app"), true},
+		{"several audiences without azp", with("aud", []string{"chirpy", "another-app"}), true},
+		{"wrong issuer", with("iss", "https://evil.example.com"), true},
+		{"expired", with("exp", time.Now().Add(-time.Hour).Unix()), true},
+		{"no subject", with("sub", ""), true},
+		{"forged signature", forgedToken, true},
+		{"symmetric signature", hmacToken, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tt.token, "n")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	stub := newStubProvider(t)
+	p := stub.provider()
+	ctx := context.Background()
+
+	if _, err := p.Verify(ctx, stub.sign("key-1", stub.validClaims("n")), "n"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// a token signed with a key the cache has not seen makes it refetch the keys,
+	// but only once per refresh interval
+	stub.addKey("key-2")
+	now := time.Now()
+	p.keys.now = func() time.Time { return now }
+	if _, err := p.Verify(ctx, stub.sign("key-2", stub.validClaims("n")), "n"); err == nil {
+		t.Errorf("Verify() refetched keys before the refresh interval passed")
+	}
+
+	now = now.Add(keySetRefreshInterval)
+	if _, err := p.Verify(ctx, stub.sign("key-2", stub.validClaims("n")), "n"); err != nil {
+		t.Errorf("Verify() with a rotated key error = %v", err)
+	}
+	if stub.jwksFetches != 2 {
+		t.Errorf("keys fetched %d times, want 2", stub.jwksFetches)
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": "https://evil.example.com/authorize",
+			"token_endpoint":         "https://evil.example.com/token",
+			"jwks_uri":               "https://evil.example.com/jwks",
+		})
+	}))
+	defer server.Close()
+
+	p := NewProvider(ProviderConfig{
+		Name:        "stub",
+		Issuer:      server.URL,
+		ClientID:    "chirpy",
+		RedirectURL: "https://chirpy.example.com/callback",
+	}, server.Client())
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Errorf("AuthCodeURL() trusted a discovery document for another issuer")
+	}
+}
@@ -0,0 +1,105 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage for the buckets.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit allows Requests requests per Period. Unused allowance builds up to
+// Burst requests, which defaults to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// PerSecond is how many tokens the bucket regains each second.
+func (l Limit) PerSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Refill returns the tokens in a bucket that held tokens elapsed ago.
+func (l Limit) Refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(l.capacity(), tokens+elapsed.Seconds()*l.PerSecond())
+}
+
+// Full returns the tokens in a bucket that was never used.
+func (l Limit) Full() float64 {
+	return l.capacity()
+}
+
+// Policy describes the limit in the format of the RateLimit-Policy header.
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", int(l.capacity()), int(l.Period.Seconds()))
+}
+
+// Result describes the state of a bucket after a request took from it.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+}
+
+// NewResult builds the result for a bucket holding tokens after a request
+// was allowed or denied.
+func NewResult(l Limit, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     seconds((l.capacity() - tokens) / l.PerSecond()),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / l.PerSecond())
+	}
+	return res
+}
+
+// Store keeps the token buckets. Take removes a token from the bucket with
+// the given key, creating a full bucket if there is none.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// SetHeaders writes the RateLimit-* headers and, for denied requests,
+// Retry-After.
+func SetHeaders(h http.Header, res Result) {
+	h.Set("RateLimit-Policy", res.Limit.Policy())
+	h.Set("RateLimit-Limit", strconv.Itoa(int(res.Limit.capacity())))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+	}
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := Limit{Requests: 3, Period: time.Minute}
+	take := func(key string) Result {
+		t.Helper()
+		res, err := store.Take(context.Background(), key, limit)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		return res
+	}
+
+	for i := 2; i >= 0; i-- {
+		res := take("a")
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("Take() = %+v, want allowed with %d remaining", res, i)
+		}
+	}
+
+	res := take("a")
+	if res.Allowed {
+		t.Fatalf("Take() allowed a request over the limit")
+	}
+	if res.RetryAfter != 20*time.Second {
+		t.Errorf("RetryAfter = %v, want 20s", res.RetryAfter)
+	}
+
+	if res := take("b"); !res.Allowed {
+		t.Errorf("Take() denied a request for another key")
+	}
+
+	now = start.Add(20 * time.Second)
+	if res := take("a"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Take() after refill = %+v, want allowed with 0 remaining", res)
+	}
+
+	// the bucket never holds more than the burst
+	now = start.Add(time.Hour)
+	if res := take("a"); res.Remaining != 2 {
+		t.Errorf("Take() after an hour = %+v, want 2 remaining", res)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := Limit{Requests: 10, Period: time.Minute}
+	store.Take(context.Background(), "a", limit)
+	if len(store.buckets) != 1 {
+		t.Fatalf("buckets = %d, want 1", len(store.buckets))
+	}
+
+	now = now.Add(2 * time.Minute)
+	store.Take(context.Background(), "b", limit)
+	if _, ok := store.buckets["a"]; ok {
+		t.Errorf("refilled bucket was not swept")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	limit := Limit{Requests: 10, Period: time.Minute, Burst: 20}
+
+	tests := []struct {
+		name   string
+		tokens float64
+		allow  bool
+		want   map[string]string
+	}{
+		{
+			name:   "Allowed",
+			tokens: 19,
+			allow:  true,
+			want: map[string]string{
+				"RateLimit-Policy":    "20;w=60",
+				"RateLimit-Limit":     "20",
+				"RateLimit-Remaining": "19",
+				"RateLimit-Reset":     "6",
+				"Retry-After":         "",
+			},
+		},
+		{
+			name:   "Denied",
+			tokens: 0.5,
+			allow:  false,
+			want: map[string]string{
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "117",
+				"Retry-After":         "3",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			SetHeaders(h, NewResult(limit, tt.tokens, tt.allow))
+			for name, want := range tt.want {
+				if got := h.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
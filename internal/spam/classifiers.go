@@ -0,0 +1,131 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store gives classifiers access to what has already been posted.
+type Store interface {
+	// CountRecentChirps counts the author's chirps since the given time.
+	CountRecentChirps(ctx context.Context, authorID uuid.UUID, since time.Time) (int64, error)
+	// CountDuplicateAuthors counts other accounts that posted the same body since the given time.
+	CountDuplicateAuthors(ctx context.Context, body string, authorID uuid.UUID, since time.Time) (int64, error)
+}
+
+// Duplicates scores chirps whose body other accounts posted recently, which
+// is typical of spam rings.
+type Duplicates struct {
+	Store  Store
+	Window time.Duration
+	// Limit is the number of other accounts at which the score reaches 1
+	Limit int
+}
+
+func (d Duplicates) Name() string { return "duplicates" }
+
+func (d Duplicates) Classify(ctx context.Context, chirp Chirp) (Signal, error) {
+	body := strings.TrimSpace(chirp.Body)
+	if body == "" {
+		return Signal{}, nil
+	}
+	n, err := d.Store.CountDuplicateAuthors(ctx, body, chirp.AuthorID, chirp.Now.Add(-d.Window))
+	if err != nil {
+		return Signal{}, err
+	}
+	if n == 0 {
+		return Signal{}, nil
+	}
+	return Signal{
+		Score:  ratio(n, d.Limit),
+		Reason: fmt.Sprintf("%d other accounts posted the same text in the last %v", n, d.Window),
+	}, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+\.(?:com|net|org|io|ly|xyz|info|biz|ru|cn|top)\b`)
+
+// LinkDensity scores chirps that are mostly links.
+type LinkDensity struct {
+	// MaxLinks is the number of links at which the score reaches 1
+	MaxLinks int
+}
+
+func (l LinkDensity) Name() string { return "link_density" }
+
+func (l LinkDensity) Classify(ctx context.Context, chirp Chirp) (Signal, error) {
+	links := linkPattern.FindAllString(chirp.Body, -1)
+	if len(links) == 0 {
+		return Signal{}, nil
+	}
+	words := len(strings.Fields(chirp.Body))
+
+	// a chirp that is nothing but a link is as suspicious as one with many
+	score := ratio(int64(len(links)), l.MaxLinks)
+	if density := float64(len(links)) / float64(words); density > score {
+		score = density
+	}
+	return Signal{
+		Score:  score,
+		Reason: fmt.Sprintf("%d links in %d words", len(links), words),
+	}, nil
+}
+
+// Velocity scores authors who post many chirps in a short time.
+type Velocity struct {
+	Store  Store
+	Window time.Duration
+	// Limit is the number of chirps in the window at which the score reaches 1
+	Limit int
+}
+
+func (v Velocity) Name() string { return "velocity" }
+
+func (v Velocity) Classify(ctx context.Context, chirp Chirp) (Signal, error) {
+	n, err := v.Store.CountRecentChirps(ctx, chirp.AuthorID, chirp.Now.Add(-v.Window))
+	if err != nil {
+		return Signal{}, err
+	}
+	// the chirp being classified counts too
+	n++
+	if n <= 1 {
+		return Signal{}, nil
+	}
+	return Signal{
+		Score:  ratio(n, v.Limit),
+		Reason: fmt.Sprintf("%d chirps in the last %v", n, v.Window),
+	}, nil
+}
+
+// AccountAge scores chirps from accounts younger than MinAge, more so the
+// newer the account.
+type AccountAge struct {
+	MinAge time.Duration
+}
+
+func (a AccountAge) Name() string { return "account_age" }
+
+func (a AccountAge) Classify(ctx context.Context, chirp Chirp) (Signal, error) {
+	age := chirp.Now.Sub(chirp.AuthorCreatedAt)
+	if age >= a.MinAge || a.MinAge <= 0 {
+		return Signal{}, nil
+	}
+	if age < 0 {
+		age = 0
+	}
+	return Signal{
+		Score:  1 - float64(age)/float64(a.MinAge),
+		Reason: fmt.Sprintf("account is %v old", age.Round(time.Minute)),
+	}, nil
+}
+
+func ratio(n int64, limit int) float64 {
+	if limit <= 0 {
+		return 1
+	}
+	return clamp(float64(n) / float64(limit))
+}
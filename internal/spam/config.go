@@ -0,0 +1,133 @@
+package spam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config sets up a pipeline with the built-in classifiers. It is read from a
+// JSON file; durations are given in seconds.
+type Config struct {
+	Thresholds Thresholds `json:"thresholds"`
+	// RateLimitSeconds is how long an author is stopped from posting after a rate_limit verdict
+	RateLimitSeconds int         `json:"rate_limit_seconds"`
+	Rules            RulesConfig `json:"rules"`
+}
+
+type RulesConfig struct {
+	Duplicates  RuleConfig `json:"duplicates"`
+	LinkDensity RuleConfig `json:"link_density"`
+	Velocity    RuleConfig `json:"velocity"`
+	AccountAge  RuleConfig `json:"account_age"`
+}
+
+// RuleConfig configures one classifier. Not every field applies to every
+// classifier: Limit is the number of duplicates, links or chirps at which
+// the classifier is certain, WindowSeconds the period looked back over and
+// MinAgeSeconds the age from which accounts are trusted.
+type RuleConfig struct {
+	Enabled       bool    `json:"enabled"`
+	Weight        float64 `json:"weight"`
+	Limit         int     `json:"limit,omitempty"`
+	WindowSeconds int     `json:"window_seconds,omitempty"`
+	MinAgeSeconds int     `json:"min_age_seconds,omitempty"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Thresholds:       Thresholds{Hold: 0.5, RateLimit: 0.75, Reject: 0.9},
+		RateLimitSeconds: 10 * 60,
+		Rules: RulesConfig{
+			Duplicates:  RuleConfig{Enabled: true, Weight: 0.6, Limit: 3, WindowSeconds: 60 * 60},
+			LinkDensity: RuleConfig{Enabled: true, Weight: 0.3, Limit: 3},
+			Velocity:    RuleConfig{Enabled: true, Weight: 0.4, Limit: 10, WindowSeconds: 60},
+			AccountAge:  RuleConfig{Enabled: true, Weight: 0.2, MinAgeSeconds: 24 * 60 * 60},
+		},
+	}
+}
+
+// LoadConfig reads a config file. Settings missing from the file keep their
+// default values.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := DefaultConfig()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid spam config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c Config) Validate() error {
+	t := c.Thresholds
+	if t.Hold <= 0 || t.Hold > t.RateLimit || t.RateLimit > t.Reject || t.Reject > 1 {
+		return errors.New("thresholds must satisfy 0 < hold <= rate_limit <= reject <= 1")
+	}
+	if c.RateLimitSeconds <= 0 {
+		return errors.New("rate_limit_seconds must be positive")
+	}
+
+	rules := map[string]RuleConfig{
+		"duplicates":   c.Rules.Duplicates,
+		"link_density": c.Rules.LinkDensity,
+		"velocity":     c.Rules.Velocity,
+		"account_age":  c.Rules.AccountAge,
+	}
+	for name, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.Weight < 0 {
+			return fmt.Errorf("%s: weight cannot be negative", name)
+		}
+		if name != "account_age" && rule.Limit <= 0 {
+			return fmt.Errorf("%s: limit must be positive", name)
+		}
+	}
+	if c.Rules.Duplicates.Enabled && c.Rules.Duplicates.WindowSeconds <= 0 {
+		return errors.New("duplicates: window_seconds must be positive")
+	}
+	if c.Rules.Velocity.Enabled && c.Rules.Velocity.WindowSeconds <= 0 {
+		return errors.New("velocity: window_seconds must be positive")
+	}
+	if c.Rules.AccountAge.Enabled && c.Rules.AccountAge.MinAgeSeconds <= 0 {
+		return errors.New("account_age: min_age_seconds must be positive")
+	}
+	return nil
+}
+
+func (c Config) RateLimit() time.Duration {
+	return time.Duration(c.RateLimitSeconds) * time.Second
+}
+
+// New builds a pipeline with the enabled built-in classifiers.
+func New(cfg Config, store Store) *Pipeline {
+	p := NewPipeline(cfg.Thresholds)
+	rules := cfg.Rules
+	if rules.Duplicates.Enabled {
+		p.Add(Duplicates{Store: store, Window: seconds(rules.Duplicates.WindowSeconds), Limit: rules.Duplicates.Limit}, rules.Duplicates.Weight)
+	}
+	if rules.LinkDensity.Enabled {
+		p.Add(LinkDensity{MaxLinks: rules.LinkDensity.Limit}, rules.LinkDensity.Weight)
+	}
+	if rules.Velocity.Enabled {
+		p.Add(Velocity{Store: store, Window: seconds(rules.Velocity.WindowSeconds), Limit: rules.Velocity.Limit}, rules.Velocity.Weight)
+	}
+	if rules.AccountAge.Enabled {
+		p.Add(AccountAge{MinAge: seconds(rules.AccountAge.MinAgeSeconds)}, rules.AccountAge.Weight)
+	}
+	return p
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,130 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Verdict string
+
+const (
+	// VerdictAllow publishes the chirp
+	VerdictAllow Verdict = "allow"
+	// VerdictHold publishes the chirp to its author only until a moderator reviews it
+	VerdictHold Verdict = "hold"
+	// VerdictRateLimit refuses the chirp and stops the author posting for a while
+	VerdictRateLimit Verdict = "rate_limit"
+	// VerdictReject refuses the chirp
+	VerdictReject Verdict = "reject"
+)
+
+// Chirp is what classifiers get to see of a chirp before it is stored.
+type Chirp struct {
+	Body            string
+	AuthorID        uuid.UUID
+	AuthorCreatedAt time.Time
+	Now             time.Time
+}
+
+// Signal is one classifier's opinion of a chirp. Score ranges from 0 (not
+// spam) to 1 (certainly spam).
+type Signal struct {
+	Classifier string  `json:"classifier"`
+	Score      float64 `json:"score"`
+	Weight     float64 `json:"weight"`
+	Reason     string  `json:"reason,omitempty"`
+}
+
+type Classifier interface {
+	Name() string
+	Classify(ctx context.Context, chirp Chirp) (Signal, error)
+}
+
+type Result struct {
+	// Score is the weighted sum of the signals, capped at 1
+	Score   float64
+	Verdict Verdict
+	Signals []Signal
+}
+
+// Pipeline runs every classifier over a chirp and turns the combined score
+// into a verdict.
+type Pipeline struct {
+	thresholds  Thresholds
+	classifiers []weighted
+}
+
+type weighted struct {
+	classifier Classifier
+	weight     float64
+}
+
+func NewPipeline(thresholds Thresholds) *Pipeline {
+	return &Pipeline{thresholds: thresholds}
+}
+
+// Add registers a classifier whose score counts weight towards the total.
+func (p *Pipeline) Add(classifier Classifier, weight float64) *Pipeline {
+	p.classifiers = append(p.classifiers, weighted{classifier: classifier, weight: weight})
+	return p
+}
+
+func (p *Pipeline) Evaluate(ctx context.Context, chirp Chirp) (Result, error) {
+	if chirp.Now.IsZero() {
+		chirp.Now = time.Now()
+	}
+
+	result := Result{Verdict: VerdictAllow, Signals: []Signal{}}
+	for _, c := range p.classifiers {
+		signal, err := c.classifier.Classify(ctx, chirp)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %w", c.classifier.Name(), err)
+		}
+		signal.Classifier = c.classifier.Name()
+		signal.Score = clamp(signal.Score)
+		signal.Weight = c.weight
+		result.Score += signal.Score * c.weight
+		result.Signals = append(result.Signals, signal)
+	}
+	result.Score = clamp(result.Score)
+
+	// strongest signals first so moderators see the main reason at the top
+	sort.SliceStable(result.Signals, func(i, j int) bool {
+		return result.Signals[i].Score*result.Signals[i].Weight > result.Signals[j].Score*result.Signals[j].Weight
+	})
+
+	result.Verdict = p.thresholds.verdict(result.Score)
+	return result, nil
+}
+
+type Thresholds struct {
+	Hold      float64 `json:"hold"`
+	RateLimit float64 `json:"rate_limit"`
+	Reject    float64 `json:"reject"`
+}
+
+func (t Thresholds) verdict(score float64) Verdict {
+	switch {
+	case score >= t.Reject:
+		return VerdictReject
+	case score >= t.RateLimit:
+		return VerdictRateLimit
+	case score >= t.Hold:
+		return VerdictHold
+	}
+	return VerdictAllow
+}
+
+func clamp(score float64) float64 {
+	if score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
@@ -0,0 +1,133 @@
+package spam
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeStore struct {
+	recent     int64
+	duplicates int64
+}
+
+func (s fakeStore) CountRecentChirps(ctx context.Context, authorID uuid.UUID, since time.Time) (int64, error) {
+	return s.recent, nil
+}
+
+func (s fakeStore) CountDuplicateAuthors(ctx context.Context, body string, authorID uuid.UUID, since time.Time) (int64, error) {
+	return s.duplicates, nil
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	established := now.Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		body        string
+		createdAt   time.Time
+		store       fakeStore
+		wantVerdict Verdict
+	}{
+		{
+			name:        "Ordinary chirp",
+			body:        "I had something interesting for breakfast",
+			createdAt:   established,
+			wantVerdict: VerdictAllow,
+		},
+		{
+			name:        "One link from an established account",
+			body:        "my blog post about breakfast https://example.com/breakfast",
+			createdAt:   established,
+			wantVerdict: VerdictAllow,
+		},
+		{
+			name:        "Links from a brand new account",
+			body:        "https://a.example.com https://b.example.com https://c.example.com",
+			createdAt:   now,
+			wantVerdict: VerdictHold,
+		},
+		{
+			name:        "Copied text posting quickly",
+			body:        "win a free phone now",
+			createdAt:   established,
+			store:       fakeStore{recent: 9, duplicates: 3},
+			wantVerdict: VerdictReject,
+		},
+		{
+			name:        "Copied text from a new account",
+			body:        "win a free phone now",
+			createdAt:   now,
+			store:       fakeStore{duplicates: 3},
+			wantVerdict: VerdictRateLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(DefaultConfig(), tt.store)
+			got, err := p.Evaluate(context.Background(), Chirp{
+				Body:            tt.body,
+				AuthorID:        uuid.New(),
+				AuthorCreatedAt: tt.createdAt,
+				Now:             now,
+			})
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if got.Verdict != tt.wantVerdict {
+				t.Errorf("Evaluate() verdict = %v (score %.2f, signals %+v), want %v", got.Verdict, got.Score, got.Signals, tt.wantVerdict)
+			}
+		})
+	}
+}
+
+func TestLinkDensity(t *testing.T) {
+	tests := []struct {
+		body string
+		want float64
+	}{
+		{body: "no links here", want: 0},
+		{body: "https://example.com", want: 1},
+		{body: "read this www.example.com later today please", want: 1.0 / 3},
+		{body: "visit spam.xyz", want: 0.5},
+	}
+
+	for _, tt := range tests {
+		got, err := LinkDensity{MaxLinks: 3}.Classify(context.Background(), Chirp{Body: tt.body})
+		if err != nil {
+			t.Fatalf("Classify(%q) error = %v", tt.body, err)
+		}
+		if got.Score != tt.want {
+			t.Errorf("Classify(%q) score = %v, want %v", tt.body, got.Score, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "spam.json")
+	os.WriteFile(path, []byte(`{"thresholds": {"hold": 0.4, "rate_limit": 0.6, "reject": 0.8}, "rules": {"velocity": {"enabled": false}}}`), 0o600)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Thresholds.Hold != 0.4 || cfg.Rules.Velocity.Enabled {
+		t.Errorf("LoadConfig() did not apply the file: %+v", cfg)
+	}
+	if !cfg.Rules.Duplicates.Enabled || cfg.RateLimitSeconds != DefaultConfig().RateLimitSeconds {
+		t.Errorf("LoadConfig() lost defaults: %+v", cfg)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"thresholds": {"hold": 0.9, "rate_limit": 0.5, "reject": 0.8}}`), 0o600)
+	if _, err := LoadConfig(bad); err == nil {
+		t.Errorf("LoadConfig() expected error for unordered thresholds")
+	}
+}
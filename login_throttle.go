@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// Failed logins are counted per account and per IP address. Accounts are
+// keyed by email rather than user ID so unknown emails are throttled the
+// same way as real accounts and lockouts do not reveal which emails exist.
+
+// loginAttempt is a login attempt that has been counted as a failure before
+// the password is checked, so parallel attempts cannot all get in before the
+// first failure is recorded. It is released if the login succeeds.
+type loginAttempt struct {
+	email string
+	// throttles are the account's and the address's counts with the attempt
+	throttles []database.LoginThrottle
+}
+
+// reserveLoginAttempt counts a login attempt for email from the request's
+// address, if the throttles allow one now. Otherwise it returns when the next
+// attempt is allowed.
+func (cfg *apiConfig) reserveLoginAttempt(r *http.Request, email string) (loginAttempt, time.Time, error) {
+	attempt := loginAttempt{email: email}
+	for _, key := range []string{accountThrottleKey(email), cfg.ipThrottleKey(r)} {
+		policy := loginThrottlePolicy(key)
+		throttle, err := cfg.db.ReserveLoginAttempt(r.Context(), database.ReserveLoginAttemptParams{
+			Key:          key,
+			ForgetBefore: time.Now().Add(-policy.Window),
+			Delays:       retryDelays(policy),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.releaseLoginAttempt(r.Context(), attempt)
+			retryAt, err := cfg.loginRetryAt(r.Context(), key)
+			if err != nil {
+				return loginAttempt{}, time.Time{}, err
+			}
+			return loginAttempt{}, retryAt, nil
+		} else if err != nil {
+			cfg.releaseLoginAttempt(r.Context(), attempt)
+			return loginAttempt{}, time.Time{}, err
+		}
+		attempt.throttles = append(attempt.throttles, throttle)
+	}
+	return attempt, time.Time{}, nil
+}
+
+// recordLoginFailure keeps the failure a login attempt was counted as. usr
+// is nil for unknown emails. The owner of an account is told when it gets
+// locked, by email too since they cannot log in to see the notification.
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, attempt loginAttempt, usr *database.User) {
+	for _, throttle := range attempt.throttles {
+		policy := loginThrottlePolicy(throttle.Key)
+		// notify only on the failure that locks the account, not on every one after
+		if usr == nil || !strings.HasPrefix(throttle.Key, "account:") || int(throttle.Failures) != policy.MaxAttempts {
+			continue
+		}
+		message := fmt.Sprintf("Logins to your account were locked for %v after %d failed attempts. If this was not you, change your password once you can log in again.", policy.LockoutDuration, throttle.Failures)
+		if err := notify(r.Context(), cfg.db, usr.ID, notificationLockout, message); err != nil {
+			log.Printf("failed to notify user %s of lockout: %v", usr.ID, err)
+		}
+		// sent in the background so the response time does not tell that the email has an account
+		to, userId := usr.Email, usr.ID
+		cfg.goBackground(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			err := cfg.mailer.Send(ctx, mailer.Message{
+				To:      to,
+				Subject: "Logins to your Chirpy account were locked",
+				Text:    message + "\n",
+			})
+			if err != nil {
+				log.Printf("failed to email user %s about lockout: %v", userId, err)
+			}
+		})
+		cfg.recordAudit(r, auditLockedOut, uuid.Nil, usr.ID, map[string]any{"failures": throttle.Failures, "locked_for_seconds": policy.LockoutDuration.Seconds()})
+	}
+}
+
+// clearLoginThrottle forgets an account's failed logins after a successful
+// one. Failures from the address are kept so one known password cannot be
+// used to keep guessing others, but the successful attempt is not one.
+func (cfg *apiConfig) clearLoginThrottle(ctx context.Context, attempt loginAttempt) {
+	if err := cfg.db.ClearLoginThrottle(ctx, accountThrottleKey(attempt.email)); err != nil {
+		log.Printf("failed to clear login throttle: %v", err)
+	}
+	for _, throttle := range attempt.throttles {
+		if !strings.HasPrefix(throttle.Key, "ip:") {
+			continue
+		}
+		if err := cfg.db.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{Key: throttle.Key, ReservedAt: throttle.LastFailureAt}); err != nil {
+			log.Printf("failed to release login attempt: %v", err)
+		}
+	}
+}
+
+// helpers ---------------------------------------------------------
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (cfg *apiConfig) ipThrottleKey(r *http.Request) string {
+	return "ip:" + cfg.clientIP(r)
+}
+
+func loginThrottlePolicy(key string) auth.LockoutPolicy {
+	if strings.HasPrefix(key, "ip:") {
+		return auth.IPLockoutPolicy
+	}
+	return auth.AccountLockoutPolicy
+}
+
+// releaseLoginAttempt takes back the counts of an attempt that was refused
+// or could not be made, along with the time it was counted at, so it does not
+// extend a lockout.
+func (cfg *apiConfig) releaseLoginAttempt(ctx context.Context, attempt loginAttempt) {
+	for _, throttle := range attempt.throttles {
+		if err := cfg.db.ReleaseLoginAttempt(ctx, database.ReleaseLoginAttemptParams{Key: throttle.Key, ReservedAt: throttle.LastFailureAt}); err != nil {
+			log.Printf("failed to release login attempt: %v", err)
+		}
+	}
+}
+
+// loginRetryAt returns when the throttle with key allows the next attempt.
+func (cfg *apiConfig) loginRetryAt(ctx context.Context, key string) (time.Time, error) {
+	throttles, err := cfg.db.GetLoginThrottles(ctx, []string{key})
+	if err != nil {
+		return time.Time{}, err
+	}
+	retryAt := time.Now()
+	for _, throttle := range throttles {
+		if at := loginThrottlePolicy(key).RetryAt(int(throttle.Failures), throttle.LastFailureAt); at.After(retryAt) {
+			retryAt = at
+		}
+	}
+	return retryAt, nil
+}
+
+// retryDelays lists how long a policy makes the next attempt wait after n
+// failures, at index n-1, for ReserveLoginAttempt. The last delay is the
+// lockout, which applies to every count past it.
+func retryDelays(policy auth.LockoutPolicy) []float64 {
+	delays := make([]float64, max(policy.MaxAttempts, 1))
+	for i := range delays {
+		delays[i] = policy.RetryAt(i+1, time.Time{}).Sub(time.Time{}).Seconds()
+	}
+	return delays
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+	"github.com/chaeanthony/chirpy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+//go:embed templates/login/*.html
+var loginTemplateFS embed.FS
+
+var loginTemplates = template.Must(template.ParseFS(loginTemplateFS, "templates/login/*.html"))
+
+const magicLinkTTL = 15 * time.Minute
+
+// magicLinkEmailLimit stops one inbox from being flooded with login links.
+var magicLinkEmailLimit = ratelimit.Limit{Requests: 3, Period: 15 * time.Minute}
+
+// handlerRequestMagicLink emails a login link. The response is the same
+// whether or not the email has an account, and the email is sent in the
+// background so response times do not tell either.
+func (cfg *apiConfig) handlerRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+	email := strings.TrimSpace(params.Email)
+	if email == "" {
+		WriteError(w, http.StatusBadRequest, errors.New("email is required"))
+		return
+	}
+
+	cfg.goBackground(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := cfg.sendMagicLink(ctx, email); err != nil {
+			log.Printf("failed to send magic link: %v", err)
+		}
+	})
+
+	WriteJSON(w, http.StatusAccepted, map[string]string{"message": "if the email has an account, a login link is on its way"})
+}
+
+// handlerMagicLinkPage is where login links point. Logging in takes a second
+// step so mail scanners that open links do not use them up.
+func (cfg *apiConfig) handlerMagicLinkPage(w http.ResponseWriter, r *http.Request) {
+	renderLoginPage(w, http.StatusOK, loginPage{Token: r.URL.Query().Get("token")})
+}
+
+// handlerVerifyMagicLink exchanges a login link's token for the same tokens
+// as a password login. Each link works once. The form on the link's page gets
+// HTML back instead of JSON, and is sent on to the app with the tokens.
+func (cfg *apiConfig) handlerVerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	params := parameters{}
+	fromForm := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if fromForm {
+		params.Token = r.PostFormValue("token")
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+	link, err := cfg.db.ConsumeMagicLinkToken(r.Context(), hashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeMagicLinkError(w, fromForm, http.StatusUnauthorized, errors.New("login link is invalid or has already been used"))
+		return
+	} else if err != nil {
+		writeMagicLinkError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to check login link: %v", err))
+		return
+	}
+	if time.Now().After(link.ExpiresAt) {
+		writeMagicLinkError(w, fromForm, http.StatusUnauthorized, errors.New("login link has expired"))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), link.UserID)
+	if err != nil {
+		writeMagicLinkError(w, fromForm, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if err := checkAccountUsable(usr); err != nil {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"method": "magic_link", "reason": accountState(usr)})
+		writeMagicLinkError(w, fromForm, http.StatusForbidden, err)
+		return
+	}
+	if !fromForm {
+		if cfg.requirePasskey(w, r, usr) {
+			return
+		}
+		cfg.issueSession(w, r, usr, map[string]any{"method": "magic_link"})
+		return
+	}
+
+	// the page finishes the login with the passkey in the browser
+	if usr.PasskeyRequired {
+		challenge, err := cfg.secondFactorChallenge(r, usr)
+		if err != nil {
+			writeMagicLinkError(w, fromForm, http.StatusInternalServerError, err)
+			return
+		}
+		renderLoginPage(w, http.StatusOK, loginPage{Challenge: &challenge})
+		return
+	}
+	resp, err := cfg.createSession(r, usr, map[string]any{"method": "magic_link"})
+	if err != nil {
+		writeMagicLinkError(w, fromForm, http.StatusInternalServerError, err)
+		return
+	}
+	http.Redirect(w, r, appLoginURL(resp), http.StatusSeeOther)
+}
+
+// helpers ---------------------------------------------------------
+
+// sendMagicLink emails a login link to the account with email, if there is
+// one that may log in. Earlier links of the account stop working.
+func (cfg *apiConfig) sendMagicLink(ctx context.Context, email string) error {
+	res, err := cfg.rateLimiter.Take(ctx, "magic_link_email:"+hashToken(strings.ToLower(email)), magicLinkEmailLimit)
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if !res.Allowed {
+		return nil
+	}
+
+	usr, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if checkAccountUsable(usr) != nil {
+		return nil
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DeleteExpiredMagicLinkTokens(ctx); err != nil {
+		return err
+	}
+	if err := qtx.DeleteMagicLinkTokensByUser(ctx, usr.ID); err != nil {
+		return err
+	}
+	err = qtx.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: hashToken(token),
+		UserID:    usr.ID,
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	link := cfg.publicURL + "/api/login/magic/verify?token=" + url.QueryEscape(token)
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      usr.Email,
+		Subject: "Your Chirpy login link",
+		Text: fmt.Sprintf("Open this link to log in to Chirpy:\n\n%s\n\nThe link works once and expires in %d minutes. "+
+			"If you did not ask to log in, you can ignore this email.\n", link, int(magicLinkTTL.Minutes())),
+	})
+}
+
+// loginPage is the page a magic link or an OIDC provider sends the browser
+// to, which finishes the login and hands the tokens to the app.
+type loginPage struct {
+	// Token is the magic link's token
+	Token string
+	Error string
+	// RetryURL starts the login again after an error, instead of asking for
+	// a new magic link
+	RetryURL string
+	// Challenge is set when the login needs a passkey as a second factor
+	Challenge *PasskeyChallenge
+}
+
+// writeMagicLinkError responds to a failed login link with the error as JSON,
+// or on the link's page when the page's form was used.
+func writeMagicLinkError(w http.ResponseWriter, fromForm bool, status int, err error) {
+	if !fromForm {
+		WriteError(w, status, err)
+		return
+	}
+	renderLoginPage(w, status, loginPage{Error: err.Error()})
+}
+
+func renderLoginPage(w http.ResponseWriter, status int, page loginPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := loginTemplates.ExecuteTemplate(w, "login.html", page); err != nil {
+		log.Printf("failed to render login.html: %v", err)
+	}
+}
+
+// appLoginURL hands a login's tokens to the app in the fragment of its URL,
+// which browsers do not send to servers or in Referer headers.
+func appLoginURL(resp LoginResponse) string {
+	fragment := url.Values{"token": {resp.Token}, "refresh_token": {resp.RefreshToken}}
+	if resp.PasswordResetRequired {
+		fragment.Set("password_reset_required", "true")
+	}
+	return "/app/#" + fragment.Encode()
+}
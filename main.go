@@ -1,68 +1,325 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/config"
 	"github.com/chaeanthony/chirpy/internal/database"
-	"github.com/joho/godotenv"
+	"github.com/chaeanthony/chirpy/internal/filter"
+	"github.com/chaeanthony/chirpy/internal/mailer"
+	"github.com/chaeanthony/chirpy/internal/oidc"
+	"github.com/chaeanthony/chirpy/internal/ratelimit"
+	"github.com/chaeanthony/chirpy/internal/spam"
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	godotenv.Load()
+	conf, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	log.Printf("config: %v", conf)
 
-	const filepathRoot = "."
-	const port = "8080"
+	// ctx is cancelled on SIGINT or SIGTERM to start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// get sqlc db queries
-	dbUrl := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbUrl)
+	db, err := sql.Open("postgres", conf.DBURL.Value())
 	if err != nil {
 		log.Fatal(err)
 	}
+	db.SetMaxOpenConns(conf.DBMaxOpenConns)
+	db.SetMaxIdleConns(conf.DBMaxIdleConns)
+	db.SetConnMaxLifetime(conf.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.DBConnMaxIdleTime)
 	dbQueries := database.New(db)
-	// get platform
-	platform := os.Getenv("PLATFORM")
-	// jwt
-	secret := os.Getenv("JWT_SECRET")
-	// polka
-	polkaKey := os.Getenv("POLKA_KEY")
+	// profanity filter word list, the built in rules are used without one
+	filterRules := filter.DefaultRules()
+	if conf.FilterWordsFile != "" {
+		filterRules, err = filter.LoadFile(conf.FilterWordsFile)
+		if err != nil {
+			log.Fatalf("failed to load filter word list: %v", err)
+		}
+	}
+	// spam detection rules and thresholds, the defaults are used without a config file
+	spamConfig := spam.DefaultConfig()
+	if conf.SpamConfigFile != "" {
+		spamConfig, err = spam.LoadConfig(conf.SpamConfigFile)
+		if err != nil {
+			log.Fatalf("failed to load spam config: %v", err)
+		}
+	}
+
+	// password hashing cost, see auth.DefaultArgon2Params for the defaults
+	hashParams := auth.DefaultArgon2Params
+	if conf.PasswordHashMemoryKiB != 0 {
+		hashParams.Memory = conf.PasswordHashMemoryKiB
+	}
+	if conf.PasswordHashIterations != 0 {
+		hashParams.Iterations = conf.PasswordHashIterations
+	}
+	if conf.PasswordHashParallelism != 0 {
+		hashParams.Parallelism = conf.PasswordHashParallelism
+	}
+	if err := auth.SetHashParams(hashParams); err != nil {
+		log.Fatalf("invalid password hash parameters: %v", err)
+	}
+	passwordPolicy := auth.DefaultPasswordPolicy()
+	if conf.BreachedPasswordsFile != "" {
+		if err := passwordPolicy.LoadBreachedPasswords(conf.BreachedPasswordsFile); err != nil {
+			log.Fatalf("failed to load breached passwords: %v", err)
+		}
+	}
+
+	// external login providers, none without a config file
+	oidcConfig := oidc.Config{}
+	if conf.OIDCConfigFile != "" {
+		oidcConfig, err = oidc.LoadConfig(conf.OIDCConfigFile)
+		if err != nil {
+			log.Fatalf("failed to load oidc config: %v", err)
+		}
+	}
+
+	// outgoing email is only logged unless an smtp server is configured
+	var mail mailer.Mailer = mailer.LogMailer{}
+	if conf.Mailer == "smtp" {
+		mail, err = mailer.NewSMTPMailer(conf.SMTPAddr, conf.MailFrom, conf.SMTPUsername, conf.SMTPPassword.Value())
+		if err != nil {
+			log.Fatalf("invalid smtp config: %v", err)
+		}
+	}
+	// passkeys are bound to the public url's host unless told otherwise
+	relyingParty := auth.RelyingParty{ID: conf.WebAuthnRPID, Name: "Chirpy", Origins: []string{conf.PublicURL}}
+	if relyingParty.ID == "" {
+		u, err := url.Parse(conf.PublicURL)
+		if err != nil {
+			log.Fatalf("invalid PUBLIC_URL: %v", err)
+		}
+		relyingParty.ID = u.Hostname()
+	}
+	if len(conf.WebAuthnOrigins) > 0 {
+		relyingParty.Origins = conf.WebAuthnOrigins
+	}
+
+	apiCfg := apiConfig{fileserverHits: atomic.Int32{}, db: dbQueries, dbConn: db, platform: conf.Platform, jwtSecret: conf.JWTSecret.Value(), polkaKey: conf.PolkaKey.Value(), filterRules: filterRules}
+	apiCfg.passwordPolicy = passwordPolicy
+	apiCfg.oidcProviders = map[string]*oidc.Provider{}
+	for _, providerConfig := range oidcConfig.Providers {
+		apiCfg.oidcProviders[providerConfig.Name] = oidc.NewProvider(providerConfig, &http.Client{Timeout: 10 * time.Second})
+	}
+	apiCfg.mailer = mail
+	apiCfg.publicURL = conf.PublicURL
+	apiCfg.relyingParty = relyingParty
+	apiCfg.trustedProxies = conf.TrustedProxyPrefixes()
+	apiCfg.exportDir = conf.ExportDir
+	if apiCfg.exportDir == "" {
+		apiCfg.exportDir = filepath.Join(os.TempDir(), "chirpy-exports")
+	}
+	apiCfg.spamConfig = spamConfig
+	apiCfg.spam = spam.New(spamConfig, spamStore{db: dbQueries})
+	// rate limits are kept in memory unless they need to hold across replicas
+	if conf.RateLimitStore == "postgres" {
+		apiCfg.rateLimiter = dbRateLimitStore{db: dbQueries}
+		apiCfg.goBackground(func() { apiCfg.pruneRateLimitBuckets(ctx, time.Hour) })
+	} else {
+		apiCfg.rateLimiter = ratelimit.NewMemoryStore()
+	}
+	apiCfg.chirpFilter.Store(filter.New(filterRules))
+	if err := apiCfg.reloadFilter(ctx); err != nil {
+		log.Printf("failed to load filter rules from database, using word list only: %v", err)
+	}
+	apiCfg.goBackground(func() { apiCfg.refreshFilter(ctx, time.Minute) })
 
-	apiCfg := apiConfig{fileserverHits: atomic.Int32{}, db: dbQueries, platform: platform, jwtSecret: secret, polkaKey: polkaKey}
+	// a signal stops new exports being started, the one being built may
+	// finish until the shutdown deadline
+	exportCtx, cancelExports := context.WithCancel(context.Background())
+	defer cancelExports()
+	apiCfg.goBackground(func() { apiCfg.runDataExports(ctx, exportCtx, 15*time.Second) })
+	apiCfg.goBackground(func() { apiCfg.purgeDeletedAccounts(ctx, time.Hour) })
+	apiCfg.goBackground(func() { apiCfg.pruneAuthorizationCodes(ctx, time.Hour) })
 
 	mux := http.NewServeMux()
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
+	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(conf.FileRoot)))))
 	// api routes
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
 
-	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshToken)
+	mux.Handle("POST /api/users", apiCfg.middlewareRateLimit(signupRateLimit, apiCfg.handlerCreateUser))
+	mux.HandleFunc("PUT /api/users/me/password", apiCfg.handlerChangePassword)
+	mux.Handle("POST /api/users/me/email", apiCfg.middlewareRateLimit(emailChangeRateLimit, apiCfg.handlerRequestEmailChange))
+	mux.HandleFunc("GET /api/users/email/confirm", apiCfg.handlerEmailChangePage)
+	mux.Handle("POST /api/users/email/confirm", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerConfirmEmailChange))
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.handlerDeleteAccount)
+	mux.HandleFunc("GET /api/users/restore", apiCfg.handlerRestoreAccountPage)
+	mux.Handle("POST /api/users/restore", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerRestoreAccount))
+	mux.HandleFunc("POST /api/users/me/export", apiCfg.handlerCreateDataExport)
+	mux.HandleFunc("GET /api/users/me/exports", apiCfg.handlerGetDataExports)
+	mux.HandleFunc("GET /api/exports/{exportId}", apiCfg.handlerDownloadDataExport)
+	mux.Handle("POST /api/login", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerLogin))
+	mux.Handle("POST /api/refresh", apiCfg.middlewareRateLimit(refreshRateLimit, apiCfg.handlerRefreshToken))
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.Handle("POST /api/login/magic", apiCfg.middlewareRateLimit(magicLinkRateLimit, apiCfg.handlerRequestMagicLink))
+	mux.HandleFunc("GET /api/login/magic/verify", apiCfg.handlerMagicLinkPage)
+	mux.Handle("POST /api/login/magic/verify", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerVerifyMagicLink))
+	mux.HandleFunc("GET /api/auth/oidc/{provider}/login", apiCfg.handlerOIDCLogin)
+	mux.Handle("GET /api/auth/oidc/{provider}/callback", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerOIDCCallback))
+	mux.Handle("POST /api/login/passkey/options", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerPasskeyLoginOptions))
+	mux.Handle("POST /api/login/passkey", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerPasskeyLogin))
+	mux.HandleFunc("POST /api/users/me/passkeys/options", apiCfg.handlerPasskeyRegistrationOptions)
+	mux.HandleFunc("POST /api/users/me/passkeys", apiCfg.handlerCreatePasskey)
+	mux.HandleFunc("GET /api/users/me/passkeys", apiCfg.handlerGetPasskeys)
+	mux.HandleFunc("POST /api/users/me/passkeys/confirm/options", apiCfg.handlerPasskeyConfirmOptions)
+	mux.HandleFunc("DELETE /api/users/me/passkeys/{passkeyId}", apiCfg.handlerDeletePasskey)
+	mux.HandleFunc("PUT /api/users/me/passkeys/required", apiCfg.handlerSetPasskeyRequired)
+	mux.HandleFunc("GET /api/users/me/identities", apiCfg.handlerGetIdentities)
+	mux.HandleFunc("DELETE /api/users/me/identities/{provider}", apiCfg.handlerUnlinkIdentity)
+	mux.HandleFunc("POST /api/users/{userId}/follow", apiCfg.handlerFollowUser)
+	mux.HandleFunc("DELETE /api/users/{userId}/follow", apiCfg.handlerUnfollowUser)
+	mux.HandleFunc("GET /api/users/me/preferences", apiCfg.handlerGetPreferences)
+	mux.HandleFunc("PUT /api/users/me/preferences", apiCfg.handlerUpdatePreferences)
 
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpId}", apiCfg.handlerGetChirp)
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
+	mux.Handle("POST /api/chirps", apiCfg.middlewareRateLimit(chirpRateLimit, apiCfg.handlerCreateChirp))
 	mux.HandleFunc("DELETE /api/chirps/{chirpId}", apiCfg.handlerDeleteChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpId}/bookmark", apiCfg.handlerCreateBookmark)
+	mux.HandleFunc("DELETE /api/chirps/{chirpId}/bookmark", apiCfg.handlerDeleteBookmark)
+	mux.HandleFunc("GET /api/bookmarks", apiCfg.handlerGetBookmarks)
+	mux.HandleFunc("POST /api/chirps/{chirpId}/poll/vote", apiCfg.handlerVotePoll)
+	mux.HandleFunc("POST /api/chirps/{chirpId}/pin", apiCfg.handlerPinChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpId}/pin", apiCfg.handlerUnpinChirp)
+	mux.Handle("POST /api/reports", apiCfg.middlewareRateLimit(reportRateLimit, apiCfg.handlerCreateReport))
+	mux.HandleFunc("GET /api/notifications", apiCfg.handlerGetNotifications)
+	mux.HandleFunc("POST /api/notifications/{notificationId}/read", apiCfg.handlerReadNotification)
+
+	mux.HandleFunc("POST /api/tokens", apiCfg.handlerCreatePersonalAccessToken)
+	mux.HandleFunc("GET /api/tokens", apiCfg.handlerGetPersonalAccessTokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenId}", apiCfg.handlerDeletePersonalAccessToken)
+
+	// oauth
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.handlerCreateOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.handlerGetOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientId}", apiCfg.handlerDeleteOAuthClient)
+	mux.HandleFunc("GET /api/users/me/oauth/grants", apiCfg.handlerGetOAuthGrants)
+	mux.HandleFunc("DELETE /api/users/me/oauth/grants/{grantId}", apiCfg.handlerRevokeOAuthGrant)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handlerAuthorizePage)
+	mux.Handle("POST /oauth/authorize", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerAuthorize))
+	mux.Handle("POST /oauth/token", apiCfg.middlewareRateLimit(refreshRateLimit, apiCfg.handlerOAuthToken))
+	mux.HandleFunc("POST /oauth/introspect", apiCfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.handlerOAuthRevoke)
+
 	// polka
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeUserToRed)
+	mux.Handle("POST /api/polka/webhooks", apiCfg.middlewareRateLimit(webhookRateLimit, apiCfg.handlerUpgradeUserToRed))
 
 	// admin routes
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	requireAdmin := func(next http.HandlerFunc) http.Handler {
+		return apiCfg.middlewareRequireRole(auth.RoleAdmin, next)
+	}
+	requireModerator := func(next http.HandlerFunc) http.Handler {
+		return apiCfg.middlewareRequireRole(auth.RoleModerator, next)
+	}
+	mux.Handle("GET /admin/metrics", requireAdmin(apiCfg.handlerMetrics))
+	mux.Handle("POST /admin/reset", requireAdmin(apiCfg.handlerReset))
+	mux.Handle("PUT /admin/users/{userId}/role", requireAdmin(apiCfg.handlerSetUserRole))
+	mux.Handle("GET /admin/users/{userId}/state", requireAdmin(apiCfg.handlerGetAccountState))
+	mux.Handle("PUT /admin/users/{userId}/state", requireAdmin(apiCfg.handlerSetAccountState))
+	mux.Handle("GET /admin/audit", requireAdmin(apiCfg.handlerGetAuditEvents))
+	mux.Handle("GET /admin/users", requireAdmin(apiCfg.handlerAdminSearchUsers))
+	mux.Handle("GET /admin/users/{userId}", requireAdmin(apiCfg.handlerAdminGetUser))
+	mux.Handle("POST /admin/users/{userId}/sessions/revoke", requireAdmin(apiCfg.handlerAdminRevokeSessions))
+	mux.Handle("POST /admin/users/{userId}/password-reset", requireAdmin(apiCfg.handlerAdminForcePasswordReset))
+	mux.Handle("PUT /admin/users/{userId}/chirpy-red", requireAdmin(apiCfg.handlerAdminSetChirpyRed))
+	mux.Handle("POST /admin/users/{userId}/impersonate", requireAdmin(apiCfg.handlerImpersonateUser))
+
+	// admin dashboard
+	mux.HandleFunc("GET /admin/dashboard/login", apiCfg.handlerDashboardLoginPage)
+	mux.Handle("POST /admin/dashboard/login", apiCfg.middlewareRateLimit(loginRateLimit, apiCfg.handlerDashboardLogin))
+	mux.HandleFunc("POST /admin/dashboard/logout", apiCfg.handlerDashboardLogout)
+	mux.Handle("GET /admin/dashboard", apiCfg.middlewareAdminPage(apiCfg.handlerDashboard))
+	mux.Handle("GET /admin/dashboard/users/{userId}", apiCfg.middlewareAdminPage(apiCfg.handlerDashboardUser))
+	mux.Handle("POST /admin/dashboard/users/{userId}/{action}", apiCfg.middlewareAdminPage(apiCfg.handlerDashboardUserAction))
+	mux.Handle("PUT /admin/chirps/{chirpId}/sensitive", requireModerator(apiCfg.handlerSetChirpSensitive))
+	mux.Handle("GET /admin/chirps/flagged", requireModerator(apiCfg.handlerGetChirpFlags))
+	mux.Handle("GET /admin/filter/rules", requireModerator(apiCfg.handlerGetFilterRules))
+	mux.Handle("POST /admin/filter/rules", requireModerator(apiCfg.handlerCreateFilterRule))
+	mux.Handle("DELETE /admin/filter/rules/{ruleId}", requireModerator(apiCfg.handlerDeleteFilterRule))
+	mux.Handle("GET /admin/reports", requireModerator(apiCfg.handlerGetReports))
+	mux.Handle("GET /admin/reports/{reportId}", requireModerator(apiCfg.handlerGetReport))
+	mux.Handle("POST /admin/reports/{reportId}/claim", requireModerator(apiCfg.handlerClaimReport))
+	mux.Handle("POST /admin/reports/{reportId}/resolve", requireModerator(apiCfg.handlerResolveReport))
+	mux.Handle("POST /admin/reports/{reportId}/dismiss", requireModerator(apiCfg.handlerDismissReport))
+	mux.Handle("GET /admin/spam", requireModerator(apiCfg.handlerGetSpamScores))
+	mux.Handle("POST /admin/spam/{scoreId}/approve", requireModerator(apiCfg.handlerApproveSpamScore))
+	mux.Handle("POST /admin/spam/{scoreId}/remove", requireModerator(apiCfg.handlerRemoveSpamScore))
 
+	handler := apiCfg.middlewarePersonalAccessTokens(apiCfg.middlewareAccountState(apiCfg.middlewareTokenScopes(mux, mux)))
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              ":" + conf.Port,
+		Handler:           http.MaxBytesHandler(handler, conf.MaxBodyBytes),
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		ReadTimeout:       conf.ReadTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
 	}
 
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(srv.ListenAndServe())
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Serving files from %s on port: %s\n", conf.FileRoot, conf.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// a second signal kills the server at once
+	stop()
+
+	log.Printf("shutting down, waiting up to %v for requests and background work", conf.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	context.AfterFunc(shutdownCtx, cancelExports)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to finish requests: %v", err)
+	}
+	if err := waitBackground(shutdownCtx, &apiCfg); err != nil {
+		log.Printf("failed to finish background work: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("failed to close database: %v", err)
+	}
+	log.Println("server stopped")
+}
+
+// waitBackground waits for the background work to finish, or for ctx to end.
+func waitBackground(ctx context.Context, cfg *apiConfig) error {
+	done := make(chan struct{})
+	go func() {
+		cfg.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func handlerReadiness(w http.ResponseWriter, r *http.Request) {
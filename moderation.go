@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerSetChirpSensitive(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Sensitive bool `json:"sensitive"`
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse chirp id: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected sensitive, got: %v", err))
+		return
+	}
+
+	chirp, err := cfg.db.SetChirpSensitive(r.Context(), database.SetChirpSensitiveParams{ID: chirpId, Sensitive: params.Sensitive})
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("chirp not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update chirp: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, chirpFromDB(chirp))
+}
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	adminId := userIDFromContext(r.Context())
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse user id: %v", err))
+		return
+	}
+	// keeps an admin from locking everyone out by demoting themselves
+	if userId == adminId {
+		WriteError(w, http.StatusBadRequest, errors.New("cannot change your own role"))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected role, got: %v", err))
+		return
+	}
+	role, err := auth.ParseRole(params.Role)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current, err := cfg.db.GetUserByID(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("user not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+
+	usr, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{ID: userId, Role: string(role)})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update user: %v", err))
+		return
+	}
+	cfg.recordAudit(r, auditRoleChanged, adminId, userId, map[string]any{"from": current.Role, "to": usr.Role})
+
+	WriteJSON(w, http.StatusOK, User{
+		ID:          usr.ID,
+		CreatedAt:   usr.CreatedAt,
+		UpdatedAt:   usr.UpdatedAt,
+		Email:       usr.Email,
+		IsChirpyRed: usr.IsChirpyRed,
+		Role:        usr.Role,
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationReportOutcome = "report_outcome"
+	notificationWarning       = "warning"
+	notificationSuspension    = "suspension"
+	notificationPasswordReset = "password_reset"
+	notificationLockout       = "lockout"
+	notificationDataExport    = "data_export"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dbNotifications, err := cfg.db.GetNotifications(r.Context(), database.GetNotificationsParams{UserID: userId, Limit: limit, Offset: offset})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve notifications: %v", err))
+		return
+	}
+
+	notifications := []Notification{}
+	for _, n := range dbNotifications {
+		notification := Notification{ID: n.ID, Kind: n.Kind, Message: n.Message, CreatedAt: n.CreatedAt}
+		if n.ReadAt.Valid {
+			notification.ReadAt = &n.ReadAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+
+	WriteJSON(w, http.StatusOK, notifications)
+}
+
+func (cfg *apiConfig) handlerReadNotification(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	notificationId, err := uuid.Parse(r.PathValue("notificationId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse notification id: %v", err))
+		return
+	}
+
+	n, err := cfg.db.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{ID: notificationId, UserID: userId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update notification: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("notification not found"))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func notify(ctx context.Context, q *database.Queries, userID uuid.UUID, kind, message string) error {
+	_, err := q.CreateNotification(ctx, database.CreateNotificationParams{UserID: userID, Kind: kind, Message: message})
+	return err
+}
@@ -0,0 +1,968 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+//go:embed templates/oauth/*.html
+var oauthTemplateFS embed.FS
+
+var oauthTemplates = template.Must(template.ParseFS(oauthTemplateFS, "templates/oauth/*.html"))
+
+const (
+	oauthAccessTokenTTL = time.Hour
+	oauthCodeTTL        = 10 * time.Minute
+)
+
+// scopedRoutes lists the API routes OAuth clients and personal access tokens
+// may call and the scope each one needs. Routes missing here, such as account
+// settings and the admin API, are closed to them.
+var scopedRoutes = map[string]auth.Scope{
+	"GET /api/chirps":                               auth.ScopeRead,
+	"GET /api/chirps/{chirpId}":                     auth.ScopeRead,
+	"GET /api/bookmarks":                            auth.ScopeRead,
+	"GET /api/notifications":                        auth.ScopeRead,
+	"GET /api/users/me/preferences":                 auth.ScopeRead,
+	"POST /api/chirps":                              auth.ScopeWrite,
+	"DELETE /api/chirps/{chirpId}":                  auth.ScopeWrite,
+	"POST /api/chirps/{chirpId}/bookmark":           auth.ScopeWrite,
+	"DELETE /api/chirps/{chirpId}/bookmark":         auth.ScopeWrite,
+	"POST /api/chirps/{chirpId}/poll/vote":          auth.ScopeWrite,
+	"POST /api/chirps/{chirpId}/pin":                auth.ScopeWrite,
+	"DELETE /api/chirps/{chirpId}/pin":              auth.ScopeWrite,
+	"POST /api/reports":                             auth.ScopeWrite,
+	"POST /api/notifications/{notificationId}/read": auth.ScopeWrite,
+	"PUT /api/users/me/preferences":                 auth.ScopeWrite,
+	"POST /api/users/{userId}/follow":               auth.ScopeFollow,
+	"DELETE /api/users/{userId}/follow":             auth.ScopeFollow,
+}
+
+var scopeDescriptions = map[auth.Scope]string{
+	auth.ScopeRead:   "Read your chirps, bookmarks, notifications and preferences",
+	auth.ScopeWrite:  "Post, delete, bookmark, pin and report chirps and change your preferences",
+	auth.ScopeDM:     "Read and send your direct messages",
+	auth.ScopeFollow: "Follow and unfollow users",
+}
+
+type OAuthClient struct {
+	ID string `json:"client_id"`
+	// Secret is only returned when a confidential client is registered
+	Secret       string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OAuthGrant is a user's permission for an app to act for them.
+type OAuthGrant struct {
+	ID         uuid.UUID `json:"id"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		// Scopes are the most the client may ask for, all scopes by default
+		Scopes []string `json:"scopes"`
+		// Confidential clients get a secret, public clients such as mobile apps rely on PKCE alone
+		Confidential bool `json:"confidential"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	const maxNameLength = 100
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxNameLength {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("name must be 1 to %d characters", maxNameLength))
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("at least one redirect uri is required"))
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	scopes := auth.AllScopes
+	if len(params.Scopes) > 0 {
+		if scopes, err = auth.ParseScopes(strings.Join(params.Scopes, " ")); err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create client id: %v", err))
+		return
+	}
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		if secret, err = randomToken(32); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create client secret: %v", err))
+			return
+		}
+		secretHash = sql.NullString{String: hashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		ID:           id,
+		SecretHash:   secretHash,
+		Name:         params.Name,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopeNames(scopes),
+		OwnerID:      userId,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create client: %v", err))
+		return
+	}
+
+	resp := oauthClientFromDB(client)
+	resp.Secret = secret
+	WriteJSON(w, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbClients, err := cfg.db.GetOAuthClientsByOwner(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve clients: %v", err))
+		return
+	}
+
+	clients := []OAuthClient{}
+	for _, client := range dbClients {
+		clients = append(clients, oauthClientFromDB(client))
+	}
+
+	WriteJSON(w, http.StatusOK, clients)
+}
+
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	// deleting the client deletes its grants and with them its tokens
+	n, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{ID: r.PathValue("clientId"), OwnerID: userId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete client: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("client not found"))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handlerGetOAuthGrants lists the apps the user has let act for them.
+func (cfg *apiConfig) handlerGetOAuthGrants(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbGrants, err := cfg.db.GetOAuthGrantsByUser(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve grants: %v", err))
+		return
+	}
+
+	grants := []OAuthGrant{}
+	for _, grant := range dbGrants {
+		grants = append(grants, OAuthGrant{
+			ID:         grant.ID,
+			ClientID:   grant.ClientID,
+			ClientName: grant.ClientName,
+			Scopes:     grant.Scopes,
+			CreatedAt:  grant.CreatedAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, grants)
+}
+
+// handlerRevokeOAuthGrant takes back an app's access. Its tokens stop
+// working and it has to ask the user again.
+func (cfg *apiConfig) handlerRevokeOAuthGrant(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	grantId, err := uuid.Parse(r.PathValue("grantId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse grant id: %v", err))
+		return
+	}
+
+	grant, err := cfg.db.GetOAuthGrant(r.Context(), grantId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get grant: %v", err))
+		return
+	}
+	if err != nil || grant.UserID != userId || grant.RevokedAt.Valid {
+		WriteError(w, http.StatusNotFound, errors.New("grant not found"))
+		return
+	}
+
+	if err := cfg.revokeGrant(r.Context(), grant.ID); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to revoke grant: %v", err))
+		return
+	}
+	cfg.recordAudit(r, auditTokenRevoked, userId, userId, map[string]any{"client_id": grant.ClientID, "grant_id": grant.ID})
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handlerAuthorizePage shows the consent screen of the authorization code flow.
+func (cfg *apiConfig) handlerAuthorizePage(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizeRequest(r)
+	if err != nil {
+		cfg.failAuthorize(w, r, req, err)
+		return
+	}
+	renderOAuthPage(w, http.StatusOK, newConsentPage(req, ""))
+}
+
+// handlerAuthorize handles the consent form. The user logs in on the form
+// itself so clients never see their password.
+func (cfg *apiConfig) handlerAuthorize(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		renderOAuthPage(w, http.StatusForbidden, oauthPage{Title: "Authorization failed", Error: "Cross-origin request refused."})
+		return
+	}
+
+	req, err := cfg.parseAuthorizeRequest(r)
+	if err != nil {
+		cfg.failAuthorize(w, r, req, err)
+		return
+	}
+	if r.PostFormValue("decision") != "approve" {
+		redirectWithParams(w, r, req.RedirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}})
+		return
+	}
+
+	email := r.PostFormValue("email")
+	password := r.PostFormValue("password")
+	attempt, retryAt, err := cfg.reserveLoginAttempt(r, email)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, newConsentPage(req, "Failed to check login attempts."))
+		return
+	}
+	if !retryAt.IsZero() {
+		setRetryAfter(w, retryAt)
+		renderOAuthPage(w, http.StatusTooManyRequests, newConsentPage(req, "Too many failed login attempts, try again later."))
+		return
+	}
+	usr, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		auth.CheckDummyPassword(password)
+		cfg.recordLoginFailure(r, attempt, nil)
+		renderOAuthPage(w, http.StatusUnauthorized, newConsentPage(req, "Incorrect email or password."))
+		return
+	}
+	if auth.CheckPasswordHash(password, usr.HashedPassword) != nil {
+		cfg.recordLoginFailure(r, attempt, &usr)
+		renderOAuthPage(w, http.StatusUnauthorized, newConsentPage(req, "Incorrect email or password."))
+		return
+	}
+	cfg.clearLoginThrottle(r.Context(), attempt)
+	if err := checkAccountUsable(usr); err != nil {
+		renderOAuthPage(w, http.StatusForbidden, newConsentPage(req, "This account cannot be used right now."))
+		return
+	}
+	// the form cannot ask for a passkey, so it must not let these accounts skip theirs
+	if usr.PasskeyRequired {
+		renderOAuthPage(w, http.StatusForbidden, newConsentPage(req, "This account requires a passkey, which this page does not support."))
+		return
+	}
+	cfg.rehashPassword(r.Context(), usr, password)
+
+	code, err := randomToken(32)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, newConsentPage(req, "Failed to create authorization code."))
+		return
+	}
+	err = cfg.db.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:            hashToken(code),
+		ClientID:            req.Client.ID,
+		UserID:              usr.ID,
+		Scopes:              scopeNames(req.Scopes),
+		RedirectUri:         req.RedirectURI,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, newConsentPage(req, "Failed to create authorization code."))
+		return
+	}
+
+	redirectWithParams(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// handlerOAuthToken exchanges an authorization code or a refresh token for
+// an access token.
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		Scope        string `json:"scope"`
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	var grant database.OauthGrant
+	var refreshToken string
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		grant, refreshToken, err = cfg.exchangeAuthorizationCode(r, client)
+	case "refresh_token":
+		grant, err = cfg.getRefreshTokenGrant(r.Context(), r.PostFormValue("refresh_token"), client)
+	default:
+		err = &oauthError{Code: "unsupported_grant_type", Description: "grant_type must be authorization_code or refresh_token"}
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	scopes, err := auth.ParseScopes(strings.Join(grant.Scopes, " "))
+	if err != nil {
+		writeOAuthError(w, fmt.Errorf("invalid grant scopes: %v", err))
+		return
+	}
+	// a client may ask for fewer scopes than it was granted when refreshing
+	if requested := r.PostFormValue("scope"); requested != "" && r.PostFormValue("grant_type") == "refresh_token" {
+		narrowed, err := auth.ParseScopes(requested)
+		if err != nil || !isSubset(narrowed, scopes) {
+			writeOAuthError(w, &oauthError{Code: "invalid_scope", Description: "scope exceeds the granted scopes"})
+			return
+		}
+		scopes = narrowed
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), grant.UserID)
+	if err != nil {
+		writeOAuthError(w, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if err := checkAccountUsable(usr); err != nil {
+		writeOAuthError(w, &oauthError{Code: "invalid_grant", Description: err.Error()})
+		return
+	}
+
+	accessToken, err := auth.MakeScopedJWT(usr.ID, auth.Role(usr.Role), client.ID, grant.ID, scopes, cfg.jwtSecret, oauthAccessTokenTTL)
+	if err != nil {
+		writeOAuthError(w, fmt.Errorf("failed to create token: %v", err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	WriteJSON(w, http.StatusOK, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.FormatScopes(scopes),
+	})
+}
+
+// handlerOAuthIntrospect tells a client whether one of its tokens is still
+// active, following RFC 7662.
+func (cfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	grant, token, err := cfg.findClientToken(r.Context(), r.PostFormValue("token"), client)
+	if err != nil {
+		// clients learn nothing about tokens that are not theirs
+		WriteJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+	usr, err := cfg.db.GetUserByID(r.Context(), grant.UserID)
+	if err != nil || checkAccountUsable(usr) != nil {
+		WriteJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+
+	resp := response{
+		Active:   true,
+		Scope:    strings.Join(grant.Scopes, " "),
+		ClientID: client.ID,
+		Subject:  grant.UserID.String(),
+	}
+	switch t := token.(type) {
+	case *auth.Claims:
+		resp.TokenType = "access_token"
+		resp.Scope = t.Scope
+		resp.ExpiresAt = t.ExpiresAt.Unix()
+	case database.RefreshToken:
+		resp.TokenType = "refresh_token"
+		if t.ExpiresAt.Valid {
+			resp.ExpiresAt = t.ExpiresAt.Time.Unix()
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// handlerOAuthRevoke revokes a client's access or refresh token, following
+// RFC 7009. Either one revokes the whole grant so the client has to ask the
+// user again.
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	grant, _, err := cfg.findClientToken(r.Context(), r.PostFormValue("token"), client)
+	if err != nil {
+		// unknown tokens are not an error, the client wants them gone and they are
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := cfg.revokeGrant(r.Context(), grant.ID); err != nil {
+		writeOAuthError(w, fmt.Errorf("failed to revoke token: %v", err))
+		return
+	}
+	cfg.recordAudit(r, auditTokenRevoked, grant.UserID, grant.UserID, map[string]any{"client_id": client.ID, "grant_id": grant.ID})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// middlewareTokenScopes checks that requests with an OAuth, personal access or
+// impersonation token only reach the routes in scopedRoutes their scopes
+// allow, and that the user has not revoked an OAuth client's grant with
+// DELETE /api/users/me/oauth/grants/{grantId}.
+func (cfg *apiConfig) middlewareTokenScopes(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := auth.ParseJWT(token, cfg.jwtSecret)
+		if err != nil || !claims.Delegated() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, pattern := mux.Handler(r)
+		scope, ok := scopedRoutes[pattern]
+		if !ok {
+			WriteError(w, http.StatusForbidden, errors.New("this endpoint is not available to OAuth clients, personal access tokens or impersonation tokens"))
+			return
+		}
+		if !claims.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			WriteError(w, http.StatusForbidden, fmt.Errorf("token lacks the %s scope", scope))
+			return
+		}
+		if !cfg.checkImpersonation(w, r, claims) {
+			return
+		}
+
+		// personal access tokens were checked when they were exchanged
+		if claims.GrantID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		grant, err := cfg.db.GetOAuthGrant(r.Context(), uuid.MustParse(claims.GrantID))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get grant: %v", err))
+			return
+		}
+		if err != nil || grant.RevokedAt.Valid {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			WriteError(w, http.StatusUnauthorized, errors.New("token has been revoked"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pruneAuthorizationCodes deletes expired authorization codes until ctx is
+// done. Used codes are kept until then to catch them being used again.
+func (cfg *apiConfig) pruneAuthorizationCodes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.db.DeleteExpiredAuthorizationCodes(ctx); err != nil {
+				log.Printf("failed to prune authorization codes: %v", err)
+			}
+		}
+	}
+}
+
+// helpers ---------------------------------------------------------
+
+// oauthError is an error response defined by the OAuth spec.
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		log.Printf("oauth request failed: %v", err)
+		WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oerr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	WriteJSON(w, status, map[string]string{"error": oerr.Code, "error_description": oerr.Description})
+}
+
+type authorizeRequest struct {
+	Client              database.OauthClient
+	RedirectURI         string
+	Scopes              []auth.Scope
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization
+// request. Until the redirect URI is known to belong to the client, errors
+// are shown to the user instead of being sent to the redirect URI; the
+// returned request has an empty RedirectURI in that case.
+func (cfg *apiConfig) parseAuthorizeRequest(r *http.Request) (authorizeRequest, error) {
+	req := authorizeRequest{}
+	client, err := cfg.db.GetOAuthClient(r.Context(), r.FormValue("client_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, errors.New("unknown client")
+	} else if err != nil {
+		return req, fmt.Errorf("failed to get client: %v", err)
+	}
+	req.Client = client
+
+	redirectURI := r.FormValue("redirect_uri")
+	if redirectURI == "" && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return req, errors.New("redirect uri is not registered for this client")
+	}
+	req.RedirectURI = redirectURI
+	req.State = r.FormValue("state")
+
+	if r.FormValue("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type", Description: "response_type must be code"}
+	}
+	req.CodeChallenge = r.FormValue("code_challenge")
+	req.CodeChallengeMethod = r.FormValue("code_challenge_method")
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return req, &oauthError{Code: "invalid_request", Description: "a code_challenge with code_challenge_method S256 is required"}
+	}
+
+	allowed, err := auth.ParseScopes(strings.Join(client.Scopes, " "))
+	if err != nil {
+		return req, fmt.Errorf("invalid client scopes: %v", err)
+	}
+	req.Scopes = allowed
+	if requested := r.FormValue("scope"); requested != "" {
+		scopes, err := auth.ParseScopes(requested)
+		if err != nil || !isSubset(scopes, allowed) {
+			return req, &oauthError{Code: "invalid_scope", Description: "scope is unknown or not allowed for this client"}
+		}
+		req.Scopes = scopes
+	}
+	if len(req.Scopes) == 0 {
+		return req, &oauthError{Code: "invalid_scope", Description: "no scopes requested"}
+	}
+
+	return req, nil
+}
+
+// failAuthorize reports a bad authorization request to the client through
+// its redirect URI when that is known to be safe, and to the user otherwise.
+func (cfg *apiConfig) failAuthorize(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) {
+	var oerr *oauthError
+	if req.RedirectURI != "" && errors.As(err, &oerr) {
+		redirectWithParams(w, r, req.RedirectURI, url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}, "state": {req.State}})
+		return
+	}
+	renderOAuthPage(w, http.StatusBadRequest, oauthPage{Title: "Authorization failed", Error: err.Error()})
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(r *http.Request, client database.OauthClient) (database.OauthGrant, string, error) {
+	invalid := &oauthError{Code: "invalid_grant", Description: "authorization code is invalid or expired"}
+
+	codeHash := hashToken(r.PostFormValue("code"))
+	code, err := cfg.db.GetAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthGrant{}, "", invalid
+	} else if err != nil {
+		return database.OauthGrant{}, "", err
+	}
+	if code.ClientID != client.ID || code.RedirectUri != r.PostFormValue("redirect_uri") || time.Now().After(code.ExpiresAt) {
+		return database.OauthGrant{}, "", invalid
+	}
+	if err := auth.VerifyPKCE(r.PostFormValue("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod); err != nil {
+		return database.OauthGrant{}, "", &oauthError{Code: "invalid_grant", Description: err.Error()}
+	}
+	// a code presented twice may have been stolen, so the grant it was
+	// exchanged for is revoked as well
+	if code.UsedAt.Valid {
+		return database.OauthGrant{}, "", cfg.revokeReusedCode(r.Context(), code, invalid)
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.OauthGrant{}, "", err
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.OauthGrant{}, "", err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	grant, err := qtx.CreateOAuthGrant(r.Context(), database.CreateOAuthGrantParams{
+		ClientID: client.ID,
+		UserID:   code.UserID,
+		Scopes:   code.Scopes,
+	})
+	if err != nil {
+		return database.OauthGrant{}, "", err
+	}
+	// marking the code used waits for a concurrent exchange of it to finish,
+	// so only one of them gets a grant
+	n, err := qtx.UseAuthorizationCode(r.Context(), database.UseAuthorizationCodeParams{
+		CodeHash: codeHash,
+		GrantID:  uuid.NullUUID{UUID: grant.ID, Valid: true},
+	})
+	if err != nil {
+		return database.OauthGrant{}, "", err
+	}
+	if n == 0 {
+		tx.Rollback()
+		code, err := cfg.db.GetAuthorizationCode(r.Context(), codeHash)
+		if err != nil {
+			return database.OauthGrant{}, "", err
+		}
+		return database.OauthGrant{}, "", cfg.revokeReusedCode(r.Context(), code, invalid)
+	}
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    code.UserID,
+		ExpiresAt: sql.NullTime{Valid: true, Time: time.Now().AddDate(0, 0, 60)},
+		GrantID:   uuid.NullUUID{UUID: grant.ID, Valid: true},
+	})
+	if err != nil {
+		return database.OauthGrant{}, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return database.OauthGrant{}, "", err
+	}
+
+	return grant, refreshToken, nil
+}
+
+// revokeReusedCode revokes the grant a used authorization code was exchanged
+// for and returns invalid, or the error revoking it failed with.
+func (cfg *apiConfig) revokeReusedCode(ctx context.Context, code database.OauthAuthorizationCode, invalid error) error {
+	if !code.GrantID.Valid {
+		return invalid
+	}
+	if err := cfg.revokeGrant(ctx, code.GrantID.UUID); err != nil {
+		return err
+	}
+	log.Printf("authorization code for client %s was used twice, revoked grant %s", code.ClientID, code.GrantID.UUID)
+	return invalid
+}
+
+func (cfg *apiConfig) getRefreshTokenGrant(ctx context.Context, token string, client database.OauthClient) (database.OauthGrant, error) {
+	invalid := &oauthError{Code: "invalid_grant", Description: "refresh token is invalid, expired or revoked"}
+
+	dbToken, err := cfg.db.GetToken(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthGrant{}, invalid
+	} else if err != nil {
+		return database.OauthGrant{}, err
+	}
+	if !dbToken.GrantID.Valid || dbToken.RevokedAt.Valid || (dbToken.ExpiresAt.Valid && dbToken.ExpiresAt.Time.Before(time.Now())) {
+		return database.OauthGrant{}, invalid
+	}
+
+	grant, err := cfg.db.GetOAuthGrant(ctx, dbToken.GrantID.UUID)
+	if err != nil {
+		return database.OauthGrant{}, err
+	}
+	if grant.ClientID != client.ID || grant.RevokedAt.Valid {
+		return database.OauthGrant{}, invalid
+	}
+	return grant, nil
+}
+
+// findClientToken looks up an access or refresh token issued to client. The
+// token is returned as *auth.Claims or database.RefreshToken.
+func (cfg *apiConfig) findClientToken(ctx context.Context, token string, client database.OauthClient) (database.OauthGrant, any, error) {
+	if claims, err := auth.ParseJWT(token, cfg.jwtSecret); err == nil {
+		if claims.ClientID != client.ID {
+			return database.OauthGrant{}, nil, errors.New("token belongs to another client")
+		}
+		grant, err := cfg.db.GetOAuthGrant(ctx, uuid.MustParse(claims.GrantID))
+		if err != nil {
+			return database.OauthGrant{}, nil, err
+		}
+		if grant.RevokedAt.Valid {
+			return database.OauthGrant{}, nil, errors.New("grant has been revoked")
+		}
+		return grant, claims, nil
+	}
+
+	dbToken, err := cfg.db.GetToken(ctx, token)
+	if err != nil {
+		return database.OauthGrant{}, nil, err
+	}
+	grant, err := cfg.getRefreshTokenGrant(ctx, token, client)
+	if err != nil {
+		return database.OauthGrant{}, nil, err
+	}
+	return grant, dbToken, nil
+}
+
+func (cfg *apiConfig) revokeGrant(ctx context.Context, grantID uuid.UUID) error {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.RevokeOAuthGrant(ctx, grantID); err != nil {
+		return err
+	}
+	if err := qtx.RevokeGrantRefreshTokens(ctx, uuid.NullUUID{UUID: grantID, Valid: true}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// authenticateOAuthClient identifies the client making a token, introspection
+// or revocation request, by HTTP basic auth or form parameters. Public clients
+// only send their id.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	invalid := &oauthError{Code: "invalid_client", Description: "client authentication failed"}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, invalid
+	} else if err != nil {
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash.Valid && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, invalid
+	}
+	return client, nil
+}
+
+// validateRedirectURI only allows absolute https URIs, or http ones for
+// clients running on the user's own machine.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect uri %q must be an absolute url", uri)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect uri %q cannot have a fragment", uri)
+	}
+	host := u.Hostname()
+	if u.Scheme != "https" && !(u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")) {
+		return fmt.Errorf("redirect uri %q must use https", uri)
+	}
+	return nil
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	for name, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			q.Set(name, values[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+type oauthPage struct {
+	Title  string
+	Error  string
+	Client string
+	Scopes []string
+	// Params carry the authorization request through the consent form
+	Params map[string]string
+}
+
+func newConsentPage(req authorizeRequest, errMessage string) oauthPage {
+	page := oauthPage{
+		Title:  "Authorize " + req.Client.Name,
+		Error:  errMessage,
+		Client: req.Client.Name,
+		Params: map[string]string{
+			"response_type":         "code",
+			"client_id":             req.Client.ID,
+			"redirect_uri":          req.RedirectURI,
+			"scope":                 auth.FormatScopes(req.Scopes),
+			"state":                 req.State,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+		},
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	return page
+}
+
+func renderOAuthPage(w http.ResponseWriter, status int, page oauthPage) {
+	// the consent screen must not be framed by the client to trick users into approving
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := oauthTemplates.ExecuteTemplate(w, "authorize.html", page); err != nil {
+		log.Printf("failed to render authorize.html: %v", err)
+	}
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func scopeNames(scopes []auth.Scope) []string {
+	return strings.Fields(auth.FormatScopes(scopes))
+}
+
+func isSubset(scopes, allowed []auth.Scope) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcStateCookieName = "chirpy_oidc_state"
+	oidcLoginTTL        = 10 * time.Minute
+)
+
+var (
+	errUnverifiedEmail = errors.New("the provider has not verified your email address")
+	errIdentityTaken   = errors.New("your account is already linked to another account at this provider")
+)
+
+type ExternalIdentity struct {
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// handlerOIDCLogin starts a login through an external provider by sending
+// the user there.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		WriteError(w, http.StatusNotFound, errors.New("unknown provider"))
+		return
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create state: %v", err))
+		return
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create nonce: %v", err))
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create code verifier: %v", err))
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, fmt.Errorf("provider unavailable: %v", err))
+		return
+	}
+
+	if err := cfg.db.DeleteExpiredOIDCLoginStates(r.Context()); err != nil {
+		log.Printf("failed to delete expired oidc login states: %v", err)
+	}
+	err = cfg.db.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    hashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to store login state: %v", err))
+		return
+	}
+
+	// the callback must come back to the browser that started the login
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback finishes a login through an external provider. The
+// identity is linked to the account with the same verified email, or a new
+// account is created for it. The browser is sent on to the app with the
+// tokens, like from a magic link, and errors are shown on the login page.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		renderLoginPage(w, http.StatusNotFound, loginPage{Error: "unknown provider", RetryURL: "/app/"})
+		return
+	}
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		writeOIDCError(w, provider, http.StatusUnauthorized, fmt.Errorf("login failed at provider: %s", errCode))
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		writeOIDCError(w, provider, http.StatusBadRequest, errors.New("login state does not match, start the login again"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Path: "/api/auth/oidc/", MaxAge: -1})
+
+	login, err := cfg.db.ConsumeOIDCLoginState(r.Context(), hashToken(state))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeOIDCError(w, provider, http.StatusBadRequest, errors.New("login expired, start the login again"))
+		return
+	} else if err != nil {
+		writeOIDCError(w, provider, http.StatusInternalServerError, fmt.Errorf("failed to get login state: %v", err))
+		return
+	}
+	if login.Provider != provider.Name() || time.Now().After(login.ExpiresAt) {
+		writeOIDCError(w, provider, http.StatusBadRequest, errors.New("login expired, start the login again"))
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("oidc login through %s failed: %v", provider.Name(), err)
+		writeOIDCError(w, provider, http.StatusUnauthorized, errors.New("login failed, the provider's response could not be verified"))
+		return
+	}
+
+	usr, err := cfg.userForIdentity(r, provider.Name(), idToken)
+	if errors.Is(err, errUnverifiedEmail) {
+		writeOIDCError(w, provider, http.StatusForbidden, err)
+		return
+	} else if errors.Is(err, errIdentityTaken) {
+		writeOIDCError(w, provider, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeOIDCError(w, provider, http.StatusInternalServerError, fmt.Errorf("failed to find account: %v", err))
+		return
+	}
+	if err := checkAccountUsable(usr); err != nil {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"provider": provider.Name(), "reason": accountState(usr)})
+		writeOIDCError(w, provider, http.StatusForbidden, err)
+		return
+	}
+	// the page finishes the login with the passkey in the browser
+	if usr.PasskeyRequired {
+		challenge, err := cfg.secondFactorChallenge(r, usr)
+		if err != nil {
+			writeOIDCError(w, provider, http.StatusInternalServerError, err)
+			return
+		}
+		renderLoginPage(w, http.StatusOK, loginPage{Challenge: &challenge})
+		return
+	}
+	resp, err := cfg.createSession(r, usr, map[string]any{"provider": provider.Name()})
+	if err != nil {
+		writeOIDCError(w, provider, http.StatusInternalServerError, err)
+		return
+	}
+	http.Redirect(w, r, appLoginURL(resp), http.StatusSeeOther)
+}
+
+func (cfg *apiConfig) handlerGetIdentities(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbIdentities, err := cfg.db.GetExternalIdentitiesByUser(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve identities: %v", err))
+		return
+	}
+
+	identities := []ExternalIdentity{}
+	for _, identity := range dbIdentities {
+		identities = append(identities, ExternalIdentity{
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, identities)
+}
+
+// handlerUnlinkIdentity removes an external identity from the user's account.
+// Users without a password or passkey cannot remove their last identity,
+// since they would have no way left to log in.
+func (cfg *apiConfig) handlerUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+	provider := r.PathValue("provider")
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if !usr.HasPassword {
+		count, err := cfg.db.CountExternalIdentities(r.Context(), userId)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to count identities: %v", err))
+			return
+		}
+		passkeys, err := cfg.db.CountPasskeys(r.Context(), userId)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to count passkeys: %v", err))
+			return
+		}
+		if count <= 1 && passkeys == 0 {
+			WriteError(w, http.StatusConflict, errors.New("set a password before unlinking your only login method"))
+			return
+		}
+	}
+
+	n, err := cfg.db.DeleteExternalIdentity(r.Context(), database.DeleteExternalIdentityParams{UserID: userId, Provider: provider})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to unlink identity: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("identity not found"))
+		return
+	}
+
+	cfg.recordAudit(r, auditIdentityUnlinked, userId, userId, map[string]any{"provider": provider})
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// helpers ---------------------------------------------------------
+
+// writeOIDCError shows a failed login on the login page, with a link to try
+// the provider again.
+func writeOIDCError(w http.ResponseWriter, provider *oidc.Provider, status int, err error) {
+	retryURL := "/api/auth/oidc/" + url.PathEscape(provider.Name()) + "/login"
+	renderLoginPage(w, status, loginPage{Error: err.Error(), RetryURL: retryURL})
+}
+
+// userForIdentity finds the account an external identity belongs to. A new
+// identity is linked to the account with its email if the provider verified
+// the email, and gets a new account if there is none.
+func (cfg *apiConfig) userForIdentity(r *http.Request, provider string, idToken *oidc.IDToken) (database.User, error) {
+	identity, err := cfg.db.GetExternalIdentity(r.Context(), database.GetExternalIdentityParams{Provider: provider, Subject: idToken.Subject})
+	if err == nil {
+		if err := cfg.db.TouchExternalIdentity(r.Context(), database.TouchExternalIdentityParams{Provider: provider, Subject: idToken.Subject, Email: idToken.Email}); err != nil {
+			log.Printf("failed to update identity %s/%s: %v", provider, idToken.Subject, err)
+		}
+		return cfg.db.GetUserByID(r.Context(), identity.UserID)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	// linking by an unverified email would let anyone take over the account with that email
+	if !idToken.EmailVerified || idToken.Email == "" {
+		return database.User{}, errUnverifiedEmail
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	usr, err := qtx.GetUserByEmail(r.Context(), idToken.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		usr, err = createFederatedUser(r.Context(), qtx, idToken.Email)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	_, err = qtx.CreateExternalIdentity(r.Context(), database.CreateExternalIdentityParams{
+		Provider: provider,
+		Subject:  idToken.Subject,
+		UserID:   usr.ID,
+		Email:    idToken.Email,
+	})
+	if isUniqueViolation(err) {
+		return database.User{}, errIdentityTaken
+	} else if err != nil {
+		return database.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return database.User{}, err
+	}
+
+	cfg.recordAudit(r, auditIdentityLinked, usr.ID, usr.ID, map[string]any{"provider": provider})
+	return usr, nil
+}
+
+// createFederatedUser creates an account for someone who signed up through
+// an external provider. The account gets a random password nobody knows
+// until the user sets one.
+func createFederatedUser(ctx context.Context, q *database.Queries, email string) (database.User, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return database.User{}, err
+	}
+	hash, err := auth.HashPassword(secret)
+	if err != nil {
+		return database.User{}, err
+	}
+	return q.CreateFederatedUser(ctx, database.CreateFederatedUserParams{Email: email, HashedPassword: hash})
+}
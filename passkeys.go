@@ -0,0 +1,643 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const passkeyChallengeTTL = 5 * time.Minute
+
+// what a passkey challenge was issued for
+const (
+	passkeyPurposeRegister     = "register"
+	passkeyPurposeLogin        = "login"
+	passkeyPurposeSecondFactor = "second_factor"
+	passkeyPurposeConfirm      = "confirm"
+)
+
+var errPasskeyFailed = errors.New("passkey check failed, start again")
+
+type Passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// PasskeyChallenge starts a passkey ceremony. PublicKey holds the options for
+// navigator.credentials.create or get in the WebAuthn JSON format.
+type PasskeyChallenge struct {
+	ChallengeID uuid.UUID `json:"challenge_id"`
+	// PasskeyRequired is set when a login needs a passkey as a second factor
+	PasskeyRequired bool `json:"passkey_required,omitempty"`
+	PublicKey       any  `json:"public_key"`
+}
+
+type passkeyDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// passkeyCredential is a PublicKeyCredential as browsers serialize it with
+// toJSON(). Registrations fill in AttestationObject and Transports, logins
+// AuthenticatorData, Signature and UserHandle.
+type passkeyCredential struct {
+	ID       string `json:"id"`
+	Response struct {
+		ClientDataJSON    base64URL `json:"clientDataJSON"`
+		AttestationObject base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports"`
+		AuthenticatorData base64URL `json:"authenticatorData"`
+		Signature         base64URL `json:"signature"`
+		UserHandle        base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+// handlerPasskeyRegistrationOptions starts adding a passkey to the user's account.
+func (cfg *apiConfig) handlerPasskeyRegistrationOptions(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	dbPasskeys, err := cfg.db.GetPasskeysByUser(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve passkeys: %v", err))
+		return
+	}
+	challenge, err := cfg.createPasskeyChallenge(r, uuid.NullUUID{UUID: userId, Valid: true}, passkeyPurposeRegister)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create challenge: %v", err))
+		return
+	}
+
+	type credentialParam struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	}
+	params := []credentialParam{}
+	for _, alg := range auth.PasskeyAlgorithms {
+		params = append(params, credentialParam{Type: "public-key", Alg: alg})
+	}
+
+	WriteJSON(w, http.StatusOK, PasskeyChallenge{
+		ChallengeID: challenge.ID,
+		PublicKey: map[string]any{
+			"challenge": challenge.Challenge,
+			"rp":        map[string]string{"id": cfg.relyingParty.ID, "name": cfg.relyingParty.Name},
+			"user": map[string]string{
+				"id":          base64.RawURLEncoding.EncodeToString(userId[:]),
+				"name":        usr.Email,
+				"displayName": usr.Email,
+			},
+			"pubKeyCredParams": params,
+			"timeout":          passkeyChallengeTTL.Milliseconds(),
+			// an authenticator can only hold one passkey for an account
+			"excludeCredentials": passkeyDescriptors(dbPasskeys),
+			"authenticatorSelection": map[string]string{
+				"residentKey":      "preferred",
+				"userVerification": "preferred",
+			},
+			"attestation": "none",
+		},
+	})
+}
+
+// handlerCreatePasskey finishes adding a passkey with the authenticator's
+// response to the registration challenge.
+func (cfg *apiConfig) handlerCreatePasskey(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeID uuid.UUID         `json:"challenge_id"`
+		Name        string            `json:"name"`
+		Credential  passkeyCredential `json:"credential"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 100 {
+		WriteError(w, http.StatusBadRequest, errors.New("name must be at most 100 characters"))
+		return
+	}
+
+	challenge, err := cfg.consumePasskeyChallenge(r, params.ChallengeID, passkeyPurposeRegister)
+	if err != nil || challenge.UserID.UUID != userId {
+		WriteError(w, http.StatusBadRequest, errors.New("registration expired, start again"))
+		return
+	}
+
+	passkey, err := cfg.relyingParty.VerifyRegistration(challenge.Challenge, params.Credential.Response.ClientDataJSON, params.Credential.Response.AttestationObject, false)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	transports := params.Credential.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+	dbPasskey, err := cfg.db.CreatePasskey(r.Context(), database.CreatePasskeyParams{
+		UserID:       userId,
+		CredentialID: passkey.CredentialID,
+		PublicKey:    passkey.PublicKey,
+		SignCount:    int64(passkey.SignCount),
+		Transports:   transports,
+		Name:         name,
+	})
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, errors.New("this passkey is already registered"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to store passkey: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditPasskeyAdded, userId, userId, map[string]any{"passkey_id": dbPasskey.ID, "name": name})
+
+	WriteJSON(w, http.StatusCreated, passkeyFromDB(dbPasskey))
+}
+
+func (cfg *apiConfig) handlerGetPasskeys(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbPasskeys, err := cfg.db.GetPasskeysByUser(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve passkeys: %v", err))
+		return
+	}
+
+	passkeys := []Passkey{}
+	for _, dbPasskey := range dbPasskeys {
+		passkeys = append(passkeys, passkeyFromDB(dbPasskey))
+	}
+
+	WriteJSON(w, http.StatusOK, passkeys)
+}
+
+// handlerDeletePasskey removes a passkey once the user confirms their
+// password or another passkey. Users who need a passkey to log in cannot
+// remove their last one.
+func (cfg *apiConfig) handlerDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+	passkeyId, err := uuid.Parse(r.PathValue("passkeyId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid passkey id: %v", err))
+		return
+	}
+
+	params := confirmation{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected password or a passkey, got: %v", err))
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if !cfg.confirmIdentity(w, r, usr, params) {
+		return
+	}
+	if usr.PasskeyRequired {
+		count, err := cfg.db.CountPasskeys(r.Context(), userId)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to count passkeys: %v", err))
+			return
+		}
+		if count <= 1 {
+			WriteError(w, http.StatusConflict, errors.New("turn off the passkey requirement before removing your last passkey"))
+			return
+		}
+	}
+
+	n, err := cfg.db.DeletePasskey(r.Context(), database.DeletePasskeyParams{ID: passkeyId, UserID: userId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete passkey: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("passkey not found"))
+		return
+	}
+
+	cfg.recordAudit(r, auditPasskeyRemoved, userId, userId, map[string]any{"passkey_id": passkeyId})
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handlerSetPasskeyRequired turns the passkey second factor on or off.
+// Turning it off needs the user's password or a passkey, so a stolen access
+// token cannot strip it.
+func (cfg *apiConfig) handlerSetPasskeyRequired(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Required bool `json:"required"`
+		confirmation
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	if params.Required {
+		count, err := cfg.db.CountPasskeys(r.Context(), userId)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to count passkeys: %v", err))
+			return
+		}
+		if count == 0 {
+			WriteError(w, http.StatusConflict, errors.New("add a passkey before requiring one"))
+			return
+		}
+	} else {
+		usr, err := cfg.db.GetUserByID(r.Context(), userId)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+			return
+		}
+		if usr.PasskeyRequired && !cfg.confirmIdentity(w, r, usr, params.confirmation) {
+			return
+		}
+	}
+
+	err = cfg.db.SetPasskeyRequired(r.Context(), database.SetPasskeyRequiredParams{ID: userId, PasskeyRequired: params.Required})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update user: %v", err))
+		return
+	}
+
+	cfg.recordAudit(r, auditPasskeyRequiredChanged, userId, userId, map[string]any{"required": params.Required})
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"required": params.Required})
+}
+
+// handlerPasskeyConfirmOptions starts a passkey check for a signed in user,
+// answered in the request that needs it, such as removing a passkey.
+func (cfg *apiConfig) handlerPasskeyConfirmOptions(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbPasskeys, err := cfg.db.GetPasskeysByUser(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve passkeys: %v", err))
+		return
+	}
+	if len(dbPasskeys) == 0 {
+		WriteError(w, http.StatusConflict, errors.New("no passkeys, confirm with your password instead"))
+		return
+	}
+	challenge, err := cfg.createPasskeyChallenge(r, uuid.NullUUID{UUID: userId, Valid: true}, passkeyPurposeConfirm)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create challenge: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, PasskeyChallenge{
+		ChallengeID: challenge.ID,
+		PublicKey: map[string]any{
+			"challenge":        challenge.Challenge,
+			"rpId":             cfg.relyingParty.ID,
+			"timeout":          passkeyChallengeTTL.Milliseconds(),
+			"userVerification": "required",
+			"allowCredentials": passkeyDescriptors(dbPasskeys),
+		},
+	})
+}
+
+// handlerPasskeyLoginOptions starts a passwordless login. The browser lets
+// the user pick any of their passkeys for this site.
+func (cfg *apiConfig) handlerPasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	challenge, err := cfg.createPasskeyChallenge(r, uuid.NullUUID{}, passkeyPurposeLogin)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create challenge: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, PasskeyChallenge{
+		ChallengeID: challenge.ID,
+		PublicKey: map[string]any{
+			"challenge":        challenge.Challenge,
+			"rpId":             cfg.relyingParty.ID,
+			"timeout":          passkeyChallengeTTL.Milliseconds(),
+			"userVerification": "required",
+			"allowCredentials": []passkeyDescriptor{},
+		},
+	})
+}
+
+// handlerPasskeyLogin finishes a passwordless login, or a login that needs a
+// passkey as a second factor, and responds like handlerLogin.
+func (cfg *apiConfig) handlerPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeID uuid.UUID         `json:"challenge_id"`
+		Credential  passkeyCredential `json:"credential"`
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	challenge, err := cfg.consumePasskeyChallenge(r, params.ChallengeID, passkeyPurposeLogin, passkeyPurposeSecondFactor)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, errPasskeyFailed)
+		return
+	}
+	dbPasskey, ok := cfg.verifyPasskey(w, r, challenge, params.Credential)
+	if !ok {
+		return
+	}
+
+	usr, err := cfg.db.GetUserByID(r.Context(), dbPasskey.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	if err := checkAccountUsable(usr); err != nil {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, usr.ID, map[string]any{"method": "passkey", "reason": accountState(usr)})
+		WriteError(w, http.StatusForbidden, err)
+		return
+	}
+
+	cfg.issueSession(w, r, usr, map[string]any{"method": "passkey", "second_factor": challenge.Purpose == passkeyPurposeSecondFactor})
+}
+
+// helpers ---------------------------------------------------------
+
+// requirePasskey answers a login that proved the user's password, or another
+// first factor, with a passkey challenge when the user needs a second factor.
+// It reports whether it did; otherwise the login can go ahead.
+func (cfg *apiConfig) requirePasskey(w http.ResponseWriter, r *http.Request, usr database.User) bool {
+	if !usr.PasskeyRequired {
+		return false
+	}
+
+	challenge, err := cfg.secondFactorChallenge(r, usr)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return true
+	}
+	WriteJSON(w, http.StatusAccepted, challenge)
+	return true
+}
+
+// secondFactorChallenge creates the passkey challenge requirePasskey answers
+// with, for a user who needs a second factor.
+func (cfg *apiConfig) secondFactorChallenge(r *http.Request, usr database.User) (PasskeyChallenge, error) {
+	dbPasskeys, err := cfg.db.GetPasskeysByUser(r.Context(), usr.ID)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("couldn't retrieve passkeys: %v", err)
+	}
+	challenge, err := cfg.createPasskeyChallenge(r, uuid.NullUUID{UUID: usr.ID, Valid: true}, passkeyPurposeSecondFactor)
+	if err != nil {
+		return PasskeyChallenge{}, fmt.Errorf("failed to create challenge: %v", err)
+	}
+
+	return PasskeyChallenge{
+		ChallengeID:     challenge.ID,
+		PasskeyRequired: true,
+		PublicKey: map[string]any{
+			"challenge":        challenge.Challenge,
+			"rpId":             cfg.relyingParty.ID,
+			"timeout":          passkeyChallengeTTL.Milliseconds(),
+			"userVerification": "discouraged",
+			"allowCredentials": passkeyDescriptors(dbPasskeys),
+		},
+	}, nil
+}
+
+// verifyPasskey checks a passkey's answer to a challenge and records its new
+// signature counter. It writes the response and returns false when the
+// answer is refused.
+func (cfg *apiConfig) verifyPasskey(w http.ResponseWriter, r *http.Request, challenge database.PasskeyChallenge, credential passkeyCredential) (database.Passkey, bool) {
+	credentialID, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(credential.ID, "="))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid credential id: %v", err))
+		return database.Passkey{}, false
+	}
+	dbPasskey, err := cfg.db.GetPasskeyByCredentialID(r.Context(), credentialID)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusUnauthorized, errors.New("unknown passkey"))
+		return database.Passkey{}, false
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get passkey: %v", err))
+		return database.Passkey{}, false
+	}
+	// a second factor or a confirmation must come from the challenge's account
+	if challenge.UserID.Valid && challenge.UserID.UUID != dbPasskey.UserID {
+		WriteError(w, http.StatusUnauthorized, errPasskeyFailed)
+		return database.Passkey{}, false
+	}
+	if handle := credential.Response.UserHandle; len(handle) > 0 && string(handle) != string(dbPasskey.UserID[:]) {
+		WriteError(w, http.StatusUnauthorized, errPasskeyFailed)
+		return database.Passkey{}, false
+	}
+
+	// a passkey on its own has to prove who is holding it, a second factor only that they are there
+	requireUserVerification := challenge.Purpose != passkeyPurposeSecondFactor
+	signCount, err := cfg.relyingParty.VerifyAssertion(challenge.Challenge, auth.Passkey{
+		CredentialID: dbPasskey.CredentialID,
+		PublicKey:    dbPasskey.PublicKey,
+		SignCount:    uint32(dbPasskey.SignCount),
+	}, auth.PasskeyAssertion{
+		ClientDataJSON:    credential.Response.ClientDataJSON,
+		AuthenticatorData: credential.Response.AuthenticatorData,
+		Signature:         credential.Response.Signature,
+	}, requireUserVerification)
+	if errors.Is(err, auth.ErrSignCountRegressed) {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, dbPasskey.UserID, map[string]any{"method": "passkey", "purpose": challenge.Purpose, "passkey_id": dbPasskey.ID, "reason": "sign count regressed"})
+		WriteError(w, http.StatusUnauthorized, err)
+		return database.Passkey{}, false
+	} else if err != nil {
+		cfg.recordAudit(r, auditLoginFailed, uuid.Nil, dbPasskey.UserID, map[string]any{"method": "passkey", "purpose": challenge.Purpose, "passkey_id": dbPasskey.ID, "reason": err.Error()})
+		WriteError(w, http.StatusUnauthorized, err)
+		return database.Passkey{}, false
+	}
+	if err := cfg.db.UpdatePasskeySignCount(r.Context(), database.UpdatePasskeySignCountParams{ID: dbPasskey.ID, SignCount: int64(signCount)}); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update passkey: %v", err))
+		return database.Passkey{}, false
+	}
+	return dbPasskey, true
+}
+
+// confirmation is how a signed in user proves it is them again before
+// weakening their account's security: their password, or a passkey's answer
+// to a challenge from /api/users/me/passkeys/confirm/options.
+type confirmation struct {
+	Password    string             `json:"password"`
+	ChallengeID uuid.UUID          `json:"challenge_id"`
+	Credential  *passkeyCredential `json:"credential"`
+}
+
+// confirmIdentity checks a confirmation. It writes the response and returns
+// false when the confirmation is missing or wrong.
+func (cfg *apiConfig) confirmIdentity(w http.ResponseWriter, r *http.Request, usr database.User, c confirmation) bool {
+	switch {
+	case c.ChallengeID != uuid.Nil && c.Credential != nil:
+		challenge, err := cfg.consumePasskeyChallenge(r, c.ChallengeID, passkeyPurposeConfirm)
+		if err != nil || challenge.UserID.UUID != usr.ID {
+			WriteError(w, http.StatusUnauthorized, errPasskeyFailed)
+			return false
+		}
+		_, ok := cfg.verifyPasskey(w, r, challenge, *c.Credential)
+		return ok
+	case c.Password != "" && usr.HasPassword:
+		return cfg.confirmPassword(w, r, usr, c.Password)
+	}
+	WriteError(w, http.StatusUnauthorized, errors.New("confirm with your password or a passkey"))
+	return false
+}
+
+func (cfg *apiConfig) createPasskeyChallenge(r *http.Request, userID uuid.NullUUID, purpose string) (database.PasskeyChallenge, error) {
+	challenge, err := auth.NewPasskeyChallenge()
+	if err != nil {
+		return database.PasskeyChallenge{}, err
+	}
+	if err := cfg.db.DeleteExpiredPasskeyChallenges(r.Context()); err != nil {
+		log.Printf("failed to delete expired passkey challenges: %v", err)
+	}
+	return cfg.db.CreatePasskeyChallenge(r.Context(), database.CreatePasskeyChallengeParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(passkeyChallengeTTL),
+	})
+}
+
+// consumePasskeyChallenge uses up a challenge, which must be unexpired and
+// issued for one of purposes.
+func (cfg *apiConfig) consumePasskeyChallenge(r *http.Request, id uuid.UUID, purposes ...string) (database.PasskeyChallenge, error) {
+	challenge, err := cfg.db.ConsumePasskeyChallenge(r.Context(), id)
+	if err != nil {
+		return database.PasskeyChallenge{}, err
+	}
+	for _, purpose := range purposes {
+		if challenge.Purpose == purpose && time.Now().Before(challenge.ExpiresAt) {
+			return challenge, nil
+		}
+	}
+	return database.PasskeyChallenge{}, errors.New("challenge expired or issued for something else")
+}
+
+func passkeyDescriptors(dbPasskeys []database.Passkey) []passkeyDescriptor {
+	descriptors := []passkeyDescriptor{}
+	for _, dbPasskey := range dbPasskeys {
+		descriptors = append(descriptors, passkeyDescriptor{
+			Type:       "public-key",
+			ID:         base64.RawURLEncoding.EncodeToString(dbPasskey.CredentialID),
+			Transports: dbPasskey.Transports,
+		})
+	}
+	return descriptors
+}
+
+func passkeyFromDB(p database.Passkey) Passkey {
+	passkey := Passkey{
+		ID:         p.ID,
+		Name:       p.Name,
+		Transports: p.Transports,
+		CreatedAt:  p.CreatedAt,
+	}
+	if p.LastUsedAt.Valid {
+		passkey.LastUsedAt = &p.LastUsedAt.Time
+	}
+	return passkey
+}
+
+// base64URL is binary data sent as unpadded base64url, the WebAuthn JSON
+// encoding.
+type base64URL []byte
+
+func (b *base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
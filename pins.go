@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPinnedChirps    = 1
+	maxPinnedChirpsRed = 3
+)
+
+func (cfg *apiConfig) handlerPinChirp(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse chirp id: %v", err))
+		return
+	}
+
+	// chirps the user cannot see are not found, so their existence is not revealed
+	chirp, err := cfg.getVisibleChirp(r.Context(), chirpId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("chirp not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get chirp: %v", err))
+		return
+	}
+	if chirp.UserID != userId {
+		WriteError(w, http.StatusForbidden, fmt.Errorf("incorrect chirp author"))
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// locking the user makes concurrent pins wait, so they cannot all pass the limit
+	user, err := qtx.GetUserByIDForUpdate(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+		return
+	}
+	pinned, err := qtx.GetPinnedChirpIDs(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get pinned chirps: %v", err))
+		return
+	}
+	alreadyPinned := false
+	for _, id := range pinned {
+		if id == chirp.ID {
+			alreadyPinned = true
+		}
+	}
+
+	if !alreadyPinned {
+		limit := maxPinnedChirps
+		if user.IsChirpyRed {
+			limit = maxPinnedChirpsRed
+		}
+		if len(pinned) >= limit {
+			WriteError(w, http.StatusConflict, fmt.Errorf("cannot pin more than %d chirps. unpin a chirp first", limit))
+			return
+		}
+
+		if err := qtx.PinChirp(r.Context(), database.PinChirpParams{ChirpID: chirp.ID, UserID: userId}); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to pin chirp: %v", err))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+			return
+		}
+	}
+
+	resp := chirpFromDB(chirp)
+	resp.Pinned = true
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerUnpinChirp(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse chirp id: %v", err))
+		return
+	}
+
+	n, err := cfg.db.UnpinChirp(r.Context(), database.UnpinChirpParams{ChirpID: chirpId, UserID: userId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to unpin chirp: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("pinned chirp not found"))
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
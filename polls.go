@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/filter"
+	"github.com/google/uuid"
+)
+
+type Poll struct {
+	ID        uuid.UUID    `json:"id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Closed    bool         `json:"closed"`
+	Options   []PollOption `json:"options"`
+	// VotedOptionID is the option the viewer voted for, if any
+	VotedOptionID *uuid.UUID `json:"voted_option_id,omitempty"`
+	// TotalVotes and PollOption.Votes are hidden until the viewer has voted or the poll closed
+	TotalVotes *int64 `json:"total_votes,omitempty"`
+}
+
+type PollOption struct {
+	ID    uuid.UUID `json:"id"`
+	Text  string    `json:"text"`
+	Votes *int64    `json:"votes,omitempty"`
+}
+
+type pollParameters struct {
+	Options          []string `json:"options"`
+	ExpiresInSeconds int      `json:"expires_in_seconds"`
+}
+
+func (cfg *apiConfig) handlerVotePoll(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		OptionID uuid.UUID `json:"option_id"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse chirp id: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected option_id, got: %v", err))
+		return
+	}
+
+	if _, err := cfg.getVisibleChirp(r.Context(), chirpId, userId); errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("chirp not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get chirp: %v", err))
+		return
+	}
+
+	poll, err := cfg.db.GetPollByChirpID(r.Context(), chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("poll not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get poll: %v", err))
+		return
+	}
+	if !poll.ExpiresAt.After(time.Now()) {
+		WriteError(w, http.StatusBadRequest, errors.New("poll is closed"))
+		return
+	}
+
+	options, err := cfg.db.GetPollOptionsWithVotes(r.Context(), poll.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get poll options: %v", err))
+		return
+	}
+	validOption := false
+	for _, option := range options {
+		if option.ID == params.OptionID {
+			validOption = true
+			break
+		}
+	}
+	if !validOption {
+		WriteError(w, http.StatusBadRequest, errors.New("option does not belong to this poll"))
+		return
+	}
+
+	_, err = cfg.db.CreatePollVote(r.Context(), database.CreatePollVoteParams{
+		PollID:   poll.ID,
+		OptionID: params.OptionID,
+		UserID:   userId,
+	})
+	if isUniqueViolation(err) {
+		WriteError(w, http.StatusConflict, errors.New("already voted in this poll"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to record vote: %v", err))
+		return
+	}
+
+	resp, err := cfg.getPoll(r.Context(), poll, userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get poll results: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// helpers ---------------------------------------------------------
+// validatePoll runs each option through the word filter like the chirp body.
+// The returned result merges the options' matches and is flagged when any
+// option was.
+func validatePoll(params pollParameters, f *filter.Filter) ([]string, time.Time, filter.Result, error) {
+	const minOptions = 2
+	const maxOptions = 4
+	const maxOptionLength = 50
+	const defaultExpiry = 24 * time.Hour
+	const minExpiry = 5 * time.Minute
+	const maxExpiry = 7 * 24 * time.Hour
+
+	if len(params.Options) < minOptions || len(params.Options) > maxOptions {
+		return nil, time.Time{}, filter.Result{}, fmt.Errorf("poll must have between %d and %d options", minOptions, maxOptions)
+	}
+
+	options := make([]string, 0, len(params.Options))
+	results := make([]filter.Result, 0, len(params.Options))
+	seen := map[string]struct{}{}
+	for _, option := range params.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return nil, time.Time{}, filter.Result{}, errors.New("poll options cannot be empty")
+		}
+		result := f.Apply(option)
+		if result.Rejected {
+			return nil, time.Time{}, filter.Result{}, errors.New("poll option contains prohibited language")
+		}
+		option = result.Text
+		if filter.Length(option) > maxOptionLength {
+			return nil, time.Time{}, filter.Result{}, errors.New("poll option is too long")
+		}
+		// compared after masking, since two masked options read the same
+		if _, ok := seen[strings.ToLower(option)]; ok {
+			return nil, time.Time{}, filter.Result{}, errors.New("poll options must be unique")
+		}
+		seen[strings.ToLower(option)] = struct{}{}
+		options = append(options, option)
+		results = append(results, result)
+	}
+
+	expiresIn := defaultExpiry
+	if params.ExpiresInSeconds != 0 {
+		expiresIn = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	if expiresIn < minExpiry || expiresIn > maxExpiry {
+		return nil, time.Time{}, filter.Result{}, fmt.Errorf("poll expiry must be between %v and %v", minExpiry, maxExpiry)
+	}
+
+	return options, time.Now().Add(expiresIn), mergeFiltered(results...), nil
+}
+
+func createPoll(ctx context.Context, q *database.Queries, chirpID uuid.UUID, options []string, expiresAt time.Time) error {
+	poll, err := q.CreatePoll(ctx, database.CreatePollParams{ChirpID: chirpID, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	for i, option := range options {
+		_, err := q.CreatePollOption(ctx, database.CreatePollOptionParams{
+			PollID:   poll.ID,
+			Position: int32(i),
+			Text:     option,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPoll builds the poll response for the viewer, hiding vote counts until
+// the viewer has voted or the poll is closed.
+func (cfg *apiConfig) getPoll(ctx context.Context, poll database.Poll, viewerID uuid.UUID) (*Poll, error) {
+	options, err := cfg.db.GetPollOptionsWithVotes(ctx, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var votedOptionID *uuid.UUID
+	if viewerID != uuid.Nil {
+		vote, err := cfg.db.GetPollVote(ctx, database.GetPollVoteParams{PollID: poll.ID, UserID: viewerID})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			votedOptionID = &vote.OptionID
+		}
+	}
+
+	return buildPoll(poll, options, votedOptionID), nil
+}
+
+// attachPolls loads the polls for the given chirps, with their options, vote
+// counts and the viewer's votes, in three queries however many chirps there are.
+func (cfg *apiConfig) attachPolls(ctx context.Context, chirps []Chirp, viewerID uuid.UUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	polls, err := cfg.db.GetPollsByChirpIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if len(polls) == 0 {
+		return nil
+	}
+	byChirp := map[uuid.UUID]database.Poll{}
+	pollIDs := make([]uuid.UUID, 0, len(polls))
+	for _, poll := range polls {
+		byChirp[poll.ChirpID] = poll
+		pollIDs = append(pollIDs, poll.ID)
+	}
+
+	rows, err := cfg.db.GetPollOptionsWithVotesByPollIDs(ctx, pollIDs)
+	if err != nil {
+		return err
+	}
+	options := map[uuid.UUID][]database.GetPollOptionsWithVotesRow{}
+	for _, row := range rows {
+		options[row.PollID] = append(options[row.PollID], database.GetPollOptionsWithVotesRow{
+			ID:       row.ID,
+			Position: row.Position,
+			Text:     row.Text,
+			Votes:    row.Votes,
+		})
+	}
+
+	voted := map[uuid.UUID]uuid.UUID{}
+	if viewerID != uuid.Nil {
+		votes, err := cfg.db.GetPollVotesByUser(ctx, database.GetPollVotesByUserParams{PollIds: pollIDs, UserID: viewerID})
+		if err != nil {
+			return err
+		}
+		for _, vote := range votes {
+			voted[vote.PollID] = vote.OptionID
+		}
+	}
+
+	for i := range chirps {
+		poll, ok := byChirp[chirps[i].ID]
+		if !ok {
+			continue
+		}
+		var votedOptionID *uuid.UUID
+		if optionID, ok := voted[poll.ID]; ok {
+			votedOptionID = &optionID
+		}
+		chirps[i].Poll = buildPoll(poll, options[poll.ID], votedOptionID)
+	}
+	return nil
+}
+
+// buildPoll assembles the poll response from its options and the option the
+// viewer voted for, if any.
+func buildPoll(poll database.Poll, options []database.GetPollOptionsWithVotesRow, votedOptionID *uuid.UUID) *Poll {
+	resp := &Poll{
+		ID:            poll.ID,
+		ExpiresAt:     poll.ExpiresAt,
+		Closed:        !poll.ExpiresAt.After(time.Now()),
+		Options:       []PollOption{},
+		VotedOptionID: votedOptionID,
+	}
+
+	showResults := resp.Closed || resp.VotedOptionID != nil
+	var total int64
+	for _, option := range options {
+		o := PollOption{ID: option.ID, Text: option.Text}
+		if showResults {
+			votes := option.Votes
+			o.Votes = &votes
+		}
+		total += option.Votes
+		resp.Options = append(resp.Options, o)
+	}
+	if showResults {
+		resp.TotalVotes = &total
+	}
+
+	return resp
+}
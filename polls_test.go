@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chaeanthony/chirpy/internal/filter"
+)
+
+func TestValidatePollFiltersOptions(t *testing.T) {
+	f := filter.New([]filter.Rule{
+		{Word: "kerfuffle", Action: filter.ActionMask},
+		{Word: "sharbert", Action: filter.ActionMask},
+		{Word: "blorp", Action: filter.ActionReject},
+		{Word: "zorp", Action: filter.ActionFlag},
+	})
+
+	tests := []struct {
+		name        string
+		options     []string
+		wantOptions []string
+		wantFlagged bool
+		wantErr     bool
+	}{
+		{
+			name:        "Clean options",
+			options:     []string{"tea", "coffee"},
+			wantOptions: []string{"tea", "coffee"},
+		},
+		{
+			name:        "Masked option",
+			options:     []string{"a kerfuffle", "tea"},
+			wantOptions: []string{"a ****", "tea"},
+		},
+		{
+			name:    "Rejected option",
+			options: []string{"blorp", "tea"},
+			wantErr: true,
+		},
+		{
+			name:        "Flagged option",
+			options:     []string{"tea", "zorp"},
+			wantOptions: []string{"tea", "zorp"},
+			wantFlagged: true,
+		},
+		{
+			name:    "Options the same once masked",
+			options: []string{"kerfuffle", "sharbert"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			options, _, filtered, err := validatePoll(pollParameters{Options: tc.options}, f)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validatePoll() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(options, tc.wantOptions) {
+				t.Errorf("validatePoll() options = %q, want %q", options, tc.wantOptions)
+			}
+			if filtered.Flagged != tc.wantFlagged {
+				t.Errorf("validatePoll() flagged = %v, want %v", filtered.Flagged, tc.wantFlagged)
+			}
+		})
+	}
+}
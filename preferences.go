@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Preferences struct {
+	// AlwaysExpand shows chirps with a content warning expanded
+	AlwaysExpand bool `json:"always_expand"`
+	// HideSensitiveMedia keeps sensitive chirps collapsed, even with AlwaysExpand
+	HideSensitiveMedia bool `json:"hide_sensitive_media"`
+}
+
+func (cfg *apiConfig) handlerGetPreferences(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	prefs, err := cfg.getPreferences(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get preferences: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, prefs)
+}
+
+func (cfg *apiConfig) handlerUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := Preferences{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	prefs, err := cfg.db.UpsertUserPreferences(r.Context(), database.UpsertUserPreferencesParams{
+		UserID:             userId,
+		AlwaysExpand:       params.AlwaysExpand,
+		HideSensitiveMedia: params.HideSensitiveMedia,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to update preferences: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, Preferences{
+		AlwaysExpand:       prefs.AlwaysExpand,
+		HideSensitiveMedia: prefs.HideSensitiveMedia,
+	})
+}
+
+// getPreferences returns the user's preferences, or the defaults for anonymous
+// users and users who never saved any.
+func (cfg *apiConfig) getPreferences(ctx context.Context, userID uuid.UUID) (Preferences, error) {
+	if userID == uuid.Nil {
+		return Preferences{}, nil
+	}
+
+	prefs, err := cfg.db.GetUserPreferences(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Preferences{}, nil
+	} else if err != nil {
+		return Preferences{}, err
+	}
+
+	return Preferences{
+		AlwaysExpand:       prefs.AlwaysExpand,
+		HideSensitiveMedia: prefs.HideSensitiveMedia,
+	}, nil
+}
+
+// collapsed reports whether a chirp should be shown collapsed behind its
+// content warning for a viewer with these preferences.
+func (p Preferences) collapsed(chirp Chirp) bool {
+	if chirp.Sensitive && p.HideSensitiveMedia {
+		return true
+	}
+	if chirp.SpoilerText == "" && !chirp.Sensitive {
+		return false
+	}
+	return !p.AlwaysExpand
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/ratelimit"
+)
+
+type rateLimitKey int
+
+const (
+	rateLimitByIP rateLimitKey = iota
+	// rateLimitByUser limits anonymous requests by IP
+	rateLimitByUser
+	// rateLimitByAPIKey limits requests without an API key by IP
+	rateLimitByAPIKey
+)
+
+type rateLimitPolicy struct {
+	// name keeps the buckets of different policies apart
+	name  string
+	by    rateLimitKey
+	limit ratelimit.Limit
+	// redLimit replaces limit for Chirpy Red users when set
+	redLimit ratelimit.Limit
+}
+
+var (
+	loginRateLimit = rateLimitPolicy{
+		name:  "login",
+		by:    rateLimitByIP,
+		limit: ratelimit.Limit{Requests: 10, Period: time.Minute},
+	}
+	signupRateLimit = rateLimitPolicy{
+		name:  "signup",
+		by:    rateLimitByIP,
+		limit: ratelimit.Limit{Requests: 10, Period: time.Hour},
+	}
+	refreshRateLimit = rateLimitPolicy{
+		name:  "refresh",
+		by:    rateLimitByIP,
+		limit: ratelimit.Limit{Requests: 30, Period: time.Minute},
+	}
+	chirpRateLimit = rateLimitPolicy{
+		name:     "chirps",
+		by:       rateLimitByUser,
+		limit:    ratelimit.Limit{Requests: 10, Period: time.Minute, Burst: 20},
+		redLimit: ratelimit.Limit{Requests: 30, Period: time.Minute, Burst: 60},
+	}
+	reportRateLimit = rateLimitPolicy{
+		name:  "reports",
+		by:    rateLimitByUser,
+		limit: ratelimit.Limit{Requests: 20, Period: time.Hour},
+	}
+	magicLinkRateLimit = rateLimitPolicy{
+		name:  "magic_link",
+		by:    rateLimitByIP,
+		limit: ratelimit.Limit{Requests: 10, Period: time.Hour},
+	}
+	emailChangeRateLimit = rateLimitPolicy{
+		name:  "email_change",
+		by:    rateLimitByUser,
+		limit: ratelimit.Limit{Requests: 5, Period: time.Hour},
+	}
+	webhookRateLimit = rateLimitPolicy{
+		name:  "webhooks",
+		by:    rateLimitByAPIKey,
+		limit: ratelimit.Limit{Requests: 60, Period: time.Minute},
+	}
+)
+
+// staleRateLimitBucketAge is how long unused buckets are kept in the
+// database. It must be longer than the period of every policy.
+const staleRateLimitBucketAge = 24 * time.Hour
+
+// middlewareRateLimit refuses requests over the policy's limit with 429. If
+// the store fails requests are let through rather than taking the API down.
+func (cfg *apiConfig) middlewareRateLimit(policy rateLimitPolicy, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, limit := cfg.rateLimitKey(r, policy)
+		res, err := cfg.rateLimiter.Take(r.Context(), policy.name+":"+key, limit)
+		if err != nil {
+			log.Printf("failed to check rate limit %s: %v", policy.name, err)
+			next(w, r)
+			return
+		}
+
+		ratelimit.SetHeaders(w.Header(), res)
+		if !res.Allowed {
+			WriteError(w, http.StatusTooManyRequests, errors.New("too many requests, try again later"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// pruneRateLimitBuckets deletes unused buckets from the database until ctx
+// is done.
+func (cfg *apiConfig) pruneRateLimitBuckets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.db.DeleteStaleRateLimitBuckets(ctx, time.Now().Add(-staleRateLimitBucketAge)); err != nil {
+				log.Printf("failed to prune rate limit buckets: %v", err)
+			}
+		}
+	}
+}
+
+// helpers ---------------------------------------------------------
+
+// dbRateLimitStore keeps the buckets in Postgres so limits hold across replicas.
+type dbRateLimitStore struct {
+	db *database.Queries
+}
+
+func (s dbRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	bucket, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:             key,
+		Capacity:        limit.Full(),
+		RefillPerSecond: limit.PerSecond(),
+	})
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.NewResult(limit, bucket.Tokens, bucket.Allowed), nil
+}
+
+// rateLimitKey picks the bucket a request takes from and the limit that
+// applies to it.
+func (cfg *apiConfig) rateLimitKey(r *http.Request, policy rateLimitPolicy) (string, ratelimit.Limit) {
+	switch policy.by {
+	case rateLimitByUser:
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			break
+		}
+		userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			break
+		}
+		if policy.redLimit.Requests > 0 {
+			if usr, err := cfg.db.GetUserByID(r.Context(), userId); err == nil && usr.IsChirpyRed {
+				return "user:" + userId.String(), policy.redLimit
+			}
+		}
+		return "user:" + userId.String(), policy.limit
+	case rateLimitByAPIKey:
+		key, err := auth.GetAPIKey(r.Header)
+		if err != nil {
+			break
+		}
+		// keys are not stored in the clear
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:16]), policy.limit
+	}
+	return "ip:" + cfg.clientIP(r), policy.limit
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	reportStatusOpen      = "open"
+	reportStatusClaimed   = "claimed"
+	reportStatusResolved  = "resolved"
+	reportStatusDismissed = "dismissed"
+)
+
+const (
+	moderationRemoveChirp = "remove_chirp"
+	moderationWarn        = "warn"
+	moderationSuspendUser = "suspend_user"
+)
+
+var reportCategories = map[string]struct{}{
+	"spam":           {},
+	"harassment":     {},
+	"hate":           {},
+	"violence":       {},
+	"sexual":         {},
+	"self_harm":      {},
+	"misinformation": {},
+	"other":          {},
+}
+
+type Report struct {
+	ID             uuid.UUID          `json:"id"`
+	// ReporterID and ReportedUserID are null once the account is deleted
+	ReporterID     *uuid.UUID         `json:"reporter_id"`
+	ReportedUserID *uuid.UUID         `json:"reported_user_id"`
+	ChirpID        *uuid.UUID         `json:"chirp_id"`
+	ChirpBody      string             `json:"chirp_body,omitempty"`
+	Category       string             `json:"category"`
+	Details        string             `json:"details"`
+	Status         string             `json:"status"`
+	ClaimedBy      *uuid.UUID         `json:"claimed_by"`
+	ResolutionNote string             `json:"resolution_note"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	Actions        []ModerationAction `json:"actions,omitempty"`
+}
+
+type ModerationAction struct {
+	ID             uuid.UUID  `json:"id"`
+	ModeratorID    *uuid.UUID `json:"moderator_id"`
+	TargetUserID   *uuid.UUID `json:"target_user_id"`
+	ChirpID        *uuid.UUID `json:"chirp_id"`
+	Action         string     `json:"action"`
+	Note           string     `json:"note"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerCreateReport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChirpID  uuid.UUID `json:"chirp_id"`
+		UserID   uuid.UUID `json:"user_id"`
+		Category string    `json:"category"`
+		Details  string    `json:"details"`
+	}
+	const maxDetailsLength = 1000
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected chirp_id or user_id and category, got: %v", err))
+		return
+	}
+	if _, ok := reportCategories[params.Category]; !ok {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown report category %q", params.Category))
+		return
+	}
+	details := strings.TrimSpace(params.Details)
+	if len(details) > maxDetailsLength {
+		WriteError(w, http.StatusBadRequest, errors.New("report details are too long"))
+		return
+	}
+
+	report := database.CreateReportParams{
+		ReporterID: uuid.NullUUID{UUID: userId, Valid: true},
+		Category:   params.Category,
+		Details:    details,
+	}
+	switch {
+	case params.ChirpID != uuid.Nil:
+		chirp, err := cfg.getVisibleChirp(r.Context(), params.ChirpID, userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusNotFound, errors.New("chirp not found"))
+			return
+		} else if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get chirp: %v", err))
+			return
+		}
+		report.ReportedUserID = uuid.NullUUID{UUID: chirp.UserID, Valid: true}
+		report.ChirpID = uuid.NullUUID{UUID: chirp.ID, Valid: true}
+		report.ChirpBody = chirp.Body
+	case params.UserID != uuid.Nil:
+		if _, err := cfg.db.GetUserByID(r.Context(), params.UserID); errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		} else if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+			return
+		}
+		report.ReportedUserID = uuid.NullUUID{UUID: params.UserID, Valid: true}
+	default:
+		WriteError(w, http.StatusBadRequest, errors.New("chirp_id or user_id is required"))
+		return
+	}
+	if report.ReportedUserID.UUID == userId {
+		WriteError(w, http.StatusBadRequest, errors.New("cannot report yourself"))
+		return
+	}
+
+	dbReport, err := cfg.db.CreateReport(r.Context(), report)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create report: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, reportFromDB(dbReport))
+}
+
+func (cfg *apiConfig) handlerGetReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", reportStatusOpen, reportStatusClaimed, reportStatusResolved, reportStatusDismissed:
+	default:
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown report status %q", status))
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dbReports, err := cfg.db.GetReports(r.Context(), database.GetReportsParams{Status: status, PageLimit: limit, PageOffset: offset})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve reports: %v", err))
+		return
+	}
+
+	reports := []Report{}
+	for _, report := range dbReports {
+		reports = append(reports, reportFromDB(report))
+	}
+
+	WriteJSON(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) handlerGetReport(w http.ResponseWriter, r *http.Request) {
+	reportId, err := uuid.Parse(r.PathValue("reportId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse report id: %v", err))
+		return
+	}
+
+	report, err := cfg.getReport(r.Context(), reportId)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, errors.New("report not found"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get report: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, report)
+}
+
+func (cfg *apiConfig) handlerClaimReport(w http.ResponseWriter, r *http.Request) {
+	moderatorId := userIDFromContext(r.Context())
+
+	reportId, err := uuid.Parse(r.PathValue("reportId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse report id: %v", err))
+		return
+	}
+
+	report, err := cfg.db.ClaimReport(r.Context(), database.ClaimReportParams{
+		ID:        reportId,
+		ClaimedBy: uuid.NullUUID{UUID: moderatorId, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// either the report does not exist or someone else got to it first
+		if _, err := cfg.db.GetReportByID(r.Context(), reportId); errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusNotFound, errors.New("report not found"))
+			return
+		}
+		WriteError(w, http.StatusConflict, errors.New("report is not open"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to claim report: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, reportFromDB(report))
+}
+
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	type action struct {
+		Action       string `json:"action"`
+		Note         string `json:"note"`
+		SuspendHours int    `json:"suspend_hours"`
+	}
+	type parameters struct {
+		Actions []action `json:"actions"`
+		Note    string   `json:"note"`
+	}
+	const maxSuspendHours = 365 * 24
+
+	moderatorId := userIDFromContext(r.Context())
+
+	reportId, err := uuid.Parse(r.PathValue("reportId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse report id: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected actions, got: %v", err))
+		return
+	}
+	if len(params.Actions) == 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("at least one action is required. dismiss the report instead"))
+		return
+	}
+	for _, a := range params.Actions {
+		switch a.Action {
+		case moderationRemoveChirp, moderationWarn:
+		case moderationSuspendUser:
+			if a.SuspendHours < 1 || a.SuspendHours > maxSuspendHours {
+				WriteError(w, http.StatusBadRequest, fmt.Errorf("suspend_hours must be between 1 and %d", maxSuspendHours))
+				return
+			}
+		default:
+			WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown moderation action %q", a.Action))
+			return
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	report, err := qtx.CloseReport(r.Context(), database.CloseReportParams{
+		ID:             reportId,
+		Status:         reportStatusResolved,
+		ClosedBy:       uuid.NullUUID{UUID: moderatorId, Valid: true},
+		ResolutionNote: strings.TrimSpace(params.Note),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusConflict, errors.New("report must be claimed by you before it can be resolved"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to resolve report: %v", err))
+		return
+	}
+
+	for _, a := range params.Actions {
+		// reports outlive the accounts they are about, which cannot be acted on any more
+		if a.Action != moderationRemoveChirp && !report.ReportedUserID.Valid {
+			WriteError(w, http.StatusConflict, errors.New("the reported account has been deleted"))
+			return
+		}
+		record := database.CreateModerationActionParams{
+			ReportID:     report.ID,
+			ModeratorID:  uuid.NullUUID{UUID: moderatorId, Valid: true},
+			TargetUserID: report.ReportedUserID,
+			Action:       a.Action,
+			Note:         strings.TrimSpace(a.Note),
+		}
+
+		switch a.Action {
+		case moderationRemoveChirp:
+			if !report.ChirpID.Valid {
+				WriteError(w, http.StatusBadRequest, errors.New("report is not about a chirp"))
+				return
+			}
+			record.ChirpID = report.ChirpID
+			if err := qtx.DeleteChirp(r.Context(), report.ChirpID.UUID); err != nil {
+				WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to remove chirp: %v", err))
+				return
+			}
+		case moderationWarn:
+			message := "You have received a warning from the moderators."
+			if record.Note != "" {
+				message += " " + record.Note
+			}
+			if err := notify(r.Context(), qtx, report.ReportedUserID.UUID, notificationWarning, message); err != nil {
+				WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to warn user: %v", err))
+				return
+			}
+		case moderationSuspendUser:
+			until := time.Now().Add(time.Duration(a.SuspendHours) * time.Hour)
+			record.SuspendedUntil = sql.NullTime{Time: until, Valid: true}
+			target, err := qtx.GetUserByIDForUpdate(r.Context(), report.ReportedUserID.UUID)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get user: %v", err))
+				return
+			}
+			// staff accounts and account states are for admins to change
+			if auth.Role(target.Role).Allows(auth.RoleModerator) {
+				WriteError(w, http.StatusForbidden, errors.New("staff accounts cannot be suspended from a report. ask an admin"))
+				return
+			}
+			if state := accountState(target); state != accountActive && state != accountShadowbanned {
+				WriteError(w, http.StatusConflict, fmt.Errorf("cannot suspend a %s account. ask an admin", state))
+				return
+			}
+			reason := fmt.Sprintf("report %s", report.ID)
+			if record.Note != "" {
+				reason += ": " + record.Note
+			}
+			if _, err := setAccountState(r.Context(), qtx, target, accountSuspended, reason, record.SuspendedUntil, moderatorId); err != nil {
+				WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to suspend user: %v", err))
+				return
+			}
+			message := fmt.Sprintf("Your account has been suspended until %s.", until.UTC().Format(time.RFC1123))
+			if err := notify(r.Context(), qtx, report.ReportedUserID.UUID, notificationSuspension, message); err != nil {
+				WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to notify user: %v", err))
+				return
+			}
+		}
+
+		if _, err := qtx.CreateModerationAction(r.Context(), record); err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to record moderation action: %v", err))
+			return
+		}
+	}
+
+	message := "Thanks for your report. We reviewed it and took action."
+	if err := notifyReporter(r.Context(), qtx, report, message); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to notify reporter: %v", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+		return
+	}
+	for _, a := range params.Actions {
+		if a.Action == moderationSuspendUser {
+			cfg.recordAudit(r, auditAccountStateChange, moderatorId, report.ReportedUserID.UUID, map[string]any{"to": accountSuspended, "report_id": report.ID, "suspend_hours": a.SuspendHours})
+		}
+	}
+
+	resp, err := cfg.getReport(r.Context(), report.ID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get report: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerDismissReport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Note string `json:"note"`
+	}
+
+	moderatorId := userIDFromContext(r.Context())
+
+	reportId, err := uuid.Parse(r.PathValue("reportId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse report id: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request. expected note, got: %v", err))
+			return
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	report, err := qtx.CloseReport(r.Context(), database.CloseReportParams{
+		ID:             reportId,
+		Status:         reportStatusDismissed,
+		ClosedBy:       uuid.NullUUID{UUID: moderatorId, Valid: true},
+		ResolutionNote: strings.TrimSpace(params.Note),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusConflict, errors.New("report must be claimed by you before it can be dismissed"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to dismiss report: %v", err))
+		return
+	}
+
+	message := "Thanks for your report. We reviewed it and found it does not break our rules."
+	if err := notifyReporter(r.Context(), qtx, report, message); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to notify reporter: %v", err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to commit transaction: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, reportFromDB(report))
+}
+
+// helpers ---------------------------------------------------------
+func (cfg *apiConfig) getReport(ctx context.Context, id uuid.UUID) (Report, error) {
+	dbReport, err := cfg.db.GetReportByID(ctx, id)
+	if err != nil {
+		return Report{}, err
+	}
+	actions, err := cfg.db.GetModerationActionsByReport(ctx, id)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := reportFromDB(dbReport)
+	for _, a := range actions {
+		action := ModerationAction{
+			ID:           a.ID,
+			ModeratorID:  nullUUID(a.ModeratorID),
+			TargetUserID: nullUUID(a.TargetUserID),
+			ChirpID:      nullUUID(a.ChirpID),
+			Action:       a.Action,
+			Note:         a.Note,
+			CreatedAt:    a.CreatedAt,
+		}
+		if a.SuspendedUntil.Valid {
+			action.SuspendedUntil = &a.SuspendedUntil.Time
+		}
+		report.Actions = append(report.Actions, action)
+	}
+	return report, nil
+}
+
+// notifyReporter tells the reporter how their report was handled, unless
+// they have deleted their account since.
+func notifyReporter(ctx context.Context, q *database.Queries, report database.Report, message string) error {
+	if !report.ReporterID.Valid {
+		return nil
+	}
+	return notify(ctx, q, report.ReporterID.UUID, notificationReportOutcome, message)
+}
+
+func reportFromDB(report database.Report) Report {
+	return Report{
+		ID:             report.ID,
+		ReporterID:     nullUUID(report.ReporterID),
+		ReportedUserID: nullUUID(report.ReportedUserID),
+		ChirpID:        nullUUID(report.ChirpID),
+		ChirpBody:      report.ChirpBody,
+		Category:       report.Category,
+		Details:        report.Details,
+		Status:         report.Status,
+		ClaimedBy:      nullUUID(report.ClaimedBy),
+		ResolutionNote: report.ResolutionNote,
+		CreatedAt:      report.CreatedAt,
+		UpdatedAt:      report.UpdatedAt,
+	}
+}
+
+func nullUUID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/chaeanthony/chirpy/internal/spam"
+	"github.com/google/uuid"
+)
+
+const (
+	spamReviewApproved = "approved"
+	spamReviewRemoved  = "removed"
+)
+
+type SpamScore struct {
+	ID      uuid.UUID  `json:"id"`
+	ChirpID *uuid.UUID `json:"chirp_id"`
+	UserID  uuid.UUID  `json:"user_id"`
+	Body    string     `json:"body"`
+	Score   float64    `json:"score"`
+	Verdict string     `json:"verdict"`
+	// Signals lists what each classifier found, strongest first
+	Signals       json.RawMessage `json:"signals"`
+	ReviewOutcome string          `json:"review_outcome,omitempty"`
+	ReviewedBy    *uuid.UUID      `json:"reviewed_by"`
+	ReviewedAt    *time.Time      `json:"reviewed_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerGetSpamScores(w http.ResponseWriter, r *http.Request) {
+	verdict := r.URL.Query().Get("verdict")
+	switch spam.Verdict(verdict) {
+	case "", spam.VerdictHold, spam.VerdictRateLimit, spam.VerdictReject:
+	default:
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown verdict %q", verdict))
+		return
+	}
+	unreviewed := r.URL.Query().Get("unreviewed") == "true"
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dbScores, err := cfg.db.GetSpamScores(r.Context(), database.GetSpamScoresParams{
+		Verdict:    verdict,
+		Unreviewed: unreviewed,
+		PageLimit:  limit,
+		PageOffset: offset,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve spam scores: %v", err))
+		return
+	}
+
+	scores := []SpamScore{}
+	for _, score := range dbScores {
+		scores = append(scores, spamScoreFromDB(score))
+	}
+
+	WriteJSON(w, http.StatusOK, scores)
+}
+
+// handlerApproveSpamScore marks a verdict as a false positive: a held chirp is
+// published and a rate limited author may post again.
+func (cfg *apiConfig) handlerApproveSpamScore(w http.ResponseWriter, r *http.Request) {
+	cfg.reviewSpamScore(w, r, spamReviewApproved, func(ctx context.Context, q *database.Queries, score database.SpamScore) error {
+		if score.ChirpID.Valid {
+			if _, err := q.SetChirpHeld(ctx, database.SetChirpHeldParams{ID: score.ChirpID.UUID, Held: false}); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		if score.Verdict == string(spam.VerdictRateLimit) {
+			return q.SetPostingCooldown(ctx, database.SetPostingCooldownParams{ID: score.UserID})
+		}
+		return nil
+	})
+}
+
+// handlerRemoveSpamScore confirms a verdict, deleting the chirp if it was held.
+func (cfg *apiConfig) handlerRemoveSpamScore(w http.ResponseWriter, r *http.Request) {
+	cfg.reviewSpamScore(w, r, spamReviewRemoved, func(ctx context.Context, q *database.Queries, score database.SpamScore) error {
+		if score.ChirpID.Valid {
+			return q.DeleteChirp(ctx, score.ChirpID.UUID)
+		}
+		return nil
+	})
+}
+
+// helpers ---------------------------------------------------------
+
+// spamStore lets the spam classifiers look at stored chirps.
+type spamStore struct {
+	db *database.Queries
+}
+
+func (s spamStore) CountRecentChirps(ctx context.Context, authorID uuid.UUID, since time.Time) (int64, error) {
+	return s.db.CountRecentChirpsByAuthor(ctx, database.CountRecentChirpsByAuthorParams{UserID: authorID, CreatedAt: since})
+}
+
+func (s spamStore) CountDuplicateAuthors(ctx context.Context, body string, authorID uuid.UUID, since time.Time) (int64, error) {
+	return s.db.CountDuplicateChirpAuthors(ctx, database.CountDuplicateChirpAuthorsParams{Body: body, UserID: authorID, Since: since})
+}
+
+// checkSpam runs the spam pipeline over a new chirp. Chirps are let through
+// if the pipeline fails so an outage of the checks does not stop all posting.
+func (cfg *apiConfig) checkSpam(ctx context.Context, usr database.User, body string) spam.Result {
+	result, err := cfg.spam.Evaluate(ctx, spam.Chirp{
+		Body:            body,
+		AuthorID:        usr.ID,
+		AuthorCreatedAt: usr.CreatedAt,
+	})
+	if err != nil {
+		log.Printf("spam check failed for user %s: %v", usr.ID, err)
+		return spam.Result{Verdict: spam.VerdictAllow}
+	}
+	return result
+}
+
+// storeSpamScore records a verdict for moderators to review. Only chirps that
+// were not allowed through are recorded.
+func storeSpamScore(ctx context.Context, q *database.Queries, chirpID uuid.NullUUID, userID uuid.UUID, body string, result spam.Result) error {
+	signals, err := json.Marshal(result.Signals)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateSpamScore(ctx, database.CreateSpamScoreParams{
+		ChirpID: chirpID,
+		UserID:  userID,
+		Body:    body,
+		Score:   result.Score,
+		Verdict: string(result.Verdict),
+		Signals: signals,
+	})
+	return err
+}
+
+// reviewSpamScore records a moderator's review of a spam score and applies
+// its consequences in the same transaction.
+func (cfg *apiConfig) reviewSpamScore(w http.ResponseWriter, r *http.Request, outcome string, apply func(ctx context.Context, q *database.Queries, score database.SpamScore) error) {
+	moderatorId := userIDFromContext(r.Context())
+
+	scoreId, err := uuid.Parse(r.PathValue("scoreId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse spam score id: %v", err))
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to begin transaction: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	score, err := qtx.ReviewSpamScore(r.Context(), database.ReviewSpamScoreParams{
+		ID:            scoreId,
+		ReviewOutcome: outcome,
+		ReviewedBy:    uuid.NullUUID{UUID: moderatorId, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := cfg.db.GetSpamScoreByID(r.Context(), scoreId); errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusNotFound, errors.New("spam score not found"))
+			return
+		}
+		WriteError(w, http.StatusConflict, errors.New("spam score was already reviewed"))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to review spam score: %v", err))
+		return
+	}
+
+	if err := apply(r.Context(), qtx, score); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to review spam score: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to review spam score: %v", err))
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, spamScoreFromDB(score))
+}
+
+func spamScoreFromDB(score database.SpamScore) SpamScore {
+	s := SpamScore{
+		ID:            score.ID,
+		ChirpID:       nullUUID(score.ChirpID),
+		UserID:        score.UserID,
+		Body:          score.Body,
+		Score:         score.Score,
+		Verdict:       score.Verdict,
+		Signals:       score.Signals,
+		ReviewOutcome: score.ReviewOutcome,
+		ReviewedBy:    nullUUID(score.ReviewedBy),
+		CreatedAt:     score.CreatedAt,
+	}
+	if score.ReviewedAt.Valid {
+		s.ReviewedAt = &score.ReviewedAt.Time
+	}
+	return s
+}
@@ -0,0 +1,9 @@
+-- name: CreateAccountRestoreToken :exec
+INSERT INTO account_restore_tokens (token_hash, user_id, expires_at, created_at)
+VALUES ($1, $2, $3, NOW());
+
+-- name: DeleteAccountRestoreTokensByUser :exec
+DELETE FROM account_restore_tokens WHERE user_id = $1;
+
+-- name: ConsumeAccountRestoreToken :one
+DELETE FROM account_restore_tokens WHERE token_hash = $1 RETURNING *;
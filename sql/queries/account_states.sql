@@ -0,0 +1,7 @@
+-- name: CreateAccountStateTransition :one
+INSERT INTO account_state_transitions (id, user_id, from_state, to_state, reason, expires_at, actor_id, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW())
+RETURNING *;
+
+-- name: GetAccountStateTransitions :many
+SELECT * FROM account_state_transitions WHERE user_id = $1 ORDER BY created_at DESC;
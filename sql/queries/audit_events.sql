@@ -0,0 +1,22 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (id, action, actor_id, target_id, ip, user_agent, metadata, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW());
+
+-- name: GetAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.arg(action)::text = '' OR action = sqlc.arg(action)::text)
+  AND (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id)::uuid)
+  AND (sqlc.narg(target_id)::uuid IS NULL OR target_id = sqlc.narg(target_id)::uuid)
+  AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since)::timestamp)
+  AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until)::timestamp)
+ORDER BY created_at DESC, id
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: AnonymizeAuditEvents :exec
+UPDATE audit_events SET ip = '', user_agent = '', metadata = (
+  SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb)
+  FROM jsonb_each(audit_events.metadata)
+  WHERE key = ANY(sqlc.arg(keep_keys)::text[])
+    OR (key = 'reason' AND audit_events.action = ANY(sqlc.arg(reason_actions)::text[]))
+)
+WHERE actor_id = sqlc.arg(user_id) OR target_id = sqlc.arg(user_id);
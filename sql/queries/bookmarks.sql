@@ -0,0 +1,26 @@
+-- name: CreateBookmark :one
+INSERT INTO bookmarks (user_id, chirp_id, collection, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, chirp_id) DO UPDATE SET collection = EXCLUDED.collection
+RETURNING *;
+
+-- name: DeleteBookmark :execrows
+DELETE FROM bookmarks WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: IsChirpBookmarked :one
+SELECT EXISTS(SELECT 1 FROM bookmarks WHERE user_id = $1 AND chirp_id = $2);
+
+-- name: GetBookmarkedChirpIDs :many
+SELECT chirp_id FROM bookmarks WHERE user_id = $1;
+
+-- name: GetBookmarks :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.visibility,
+  chirps.spoiler_text, chirps.sensitive, chirps.held,
+  bookmarks.collection, bookmarks.created_at AS bookmarked_at
+FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+WHERE bookmarks.user_id = sqlc.arg(user_id)
+  AND (sqlc.arg(collection)::text = '' OR bookmarks.collection = sqlc.arg(collection)::text)
+  AND chirp_visible_to(chirps, sqlc.arg(user_id)::uuid)
+ORDER BY bookmarks.created_at DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
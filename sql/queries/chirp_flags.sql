@@ -0,0 +1,12 @@
+-- name: CreateChirpFlag :one
+INSERT INTO chirp_flags (id, chirp_id, source, reason, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+RETURNING *;
+
+-- name: GetChirpFlags :many
+SELECT chirp_flags.id, chirp_flags.chirp_id, chirp_flags.source, chirp_flags.reason, chirp_flags.created_at,
+  chirps.body, chirps.user_id
+FROM chirp_flags
+JOIN chirps ON chirps.id = chirp_flags.chirp_id
+ORDER BY chirp_flags.created_at DESC
+LIMIT $1 OFFSET $2;
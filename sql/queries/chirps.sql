@@ -1,13 +1,45 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, visibility, spoiler_text, sensitive, held)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6)
 RETURNING *;
 
--- name: GetChirps :many
-SELECT * FROM chirps;
+-- name: GetVisibleChirps :many
+SELECT * FROM chirps
+WHERE chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid);
 
 -- name: GetChirpById :one
 SELECT * FROM chirps WHERE id = $1;
 
+-- name: GetVisibleChirpById :one
+SELECT * FROM chirps
+WHERE id = sqlc.arg(id)
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid);
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: SetChirpSensitive :one
+UPDATE chirps SET sensitive = $2, updated_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: GetChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: SetChirpHeld :one
+UPDATE chirps SET held = $2, updated_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: CountRecentChirpsByAuthor :one
+SELECT COUNT(*) FROM chirps WHERE user_id = $1 AND created_at > $2;
+
+-- name: CountDuplicateChirpAuthors :one
+SELECT COUNT(DISTINCT user_id) FROM chirps
+WHERE md5(lower(body)) = md5(lower(sqlc.arg(body)::text))
+  AND user_id <> sqlc.arg(user_id)
+  AND created_at > sqlc.arg(since);
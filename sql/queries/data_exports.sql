@@ -0,0 +1,53 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at)
+VALUES (gen_random_uuid(), $1, 'pending', NOW())
+RETURNING *;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports WHERE id = $1;
+
+-- name: GetDataExportsByUser :many
+SELECT * FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: CountRecentDataExports :one
+SELECT COUNT(*) FROM data_exports WHERE user_id = $1 AND created_at > $2 AND status <> 'failed';
+
+-- name: ClaimDataExport :one
+UPDATE data_exports SET status = 'running', started_at = NOW()
+WHERE id = (
+  SELECT id FROM data_exports WHERE status = 'pending' ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RequeueDataExport :exec
+UPDATE data_exports SET status = 'pending', started_at = NULL WHERE id = $1 AND status = 'running';
+
+-- name: RequeueStaleDataExports :exec
+UPDATE data_exports SET status = 'pending', started_at = NULL WHERE status = 'running' AND started_at < $1;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports SET status = 'ready', file_path = $2, size_bytes = $3, completed_at = NOW(), expires_at = $4 WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports SET status = 'failed', completed_at = NOW() WHERE id = $1;
+
+-- name: GetExpiredDataExports :many
+SELECT * FROM data_exports WHERE status = 'ready' AND expires_at < NOW();
+
+-- name: DeleteDataExport :exec
+DELETE FROM data_exports WHERE id = $1;
+
+-- name: GetExportChirps :many
+SELECT id, created_at, updated_at, body, visibility, spoiler_text, sensitive FROM chirps WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetExportBookmarks :many
+SELECT chirp_id, collection, created_at FROM bookmarks WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetExportPollVotes :many
+SELECT poll_id, option_id, created_at FROM poll_votes WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetExportFollows :many
+SELECT * FROM follows WHERE follower_id = $1 OR followee_id = $1 ORDER BY created_at;
+
+-- name: GetExportSessions :many
+SELECT created_at, updated_at, expires_at, revoked_at, grant_id FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at;
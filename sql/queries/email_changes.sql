@@ -0,0 +1,12 @@
+-- name: CreateEmailChangeToken :exec
+INSERT INTO email_change_tokens (token_hash, user_id, new_email, expires_at, created_at)
+VALUES ($1, $2, $3, $4, NOW());
+
+-- name: DeleteEmailChangeTokensByUser :exec
+DELETE FROM email_change_tokens WHERE user_id = $1;
+
+-- name: ConsumeEmailChangeToken :one
+DELETE FROM email_change_tokens WHERE token_hash = $1 RETURNING *;
+
+-- name: DeleteExpiredEmailChangeTokens :exec
+DELETE FROM email_change_tokens WHERE expires_at < NOW();
@@ -0,0 +1,29 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states WHERE state_hash = $1 RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states WHERE expires_at < NOW();
+
+-- name: GetExternalIdentity :one
+SELECT * FROM external_identities WHERE provider = $1 AND subject = $2;
+
+-- name: GetExternalIdentitiesByUser :many
+SELECT * FROM external_identities WHERE user_id = $1 ORDER BY created_at;
+
+-- name: CreateExternalIdentity :one
+INSERT INTO external_identities (provider, subject, user_id, email, created_at, last_login_at)
+VALUES ($1, $2, $3, $4, NOW(), NOW())
+RETURNING *;
+
+-- name: TouchExternalIdentity :exec
+UPDATE external_identities SET email = $3, last_login_at = NOW() WHERE provider = $1 AND subject = $2;
+
+-- name: DeleteExternalIdentity :execrows
+DELETE FROM external_identities WHERE user_id = $1 AND provider = $2;
+
+-- name: CountExternalIdentities :one
+SELECT COUNT(*) FROM external_identities WHERE user_id = $1;
@@ -0,0 +1,10 @@
+-- name: GetFilterRules :many
+SELECT * FROM filter_rules ORDER BY word;
+
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, word, action, created_at)
+VALUES (gen_random_uuid(), $1, $2, NOW())
+RETURNING *;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE id = $1;
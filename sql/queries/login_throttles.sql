@@ -0,0 +1,31 @@
+-- name: GetLoginThrottles :many
+SELECT * FROM login_throttles WHERE key = ANY(sqlc.arg(keys)::text[]);
+
+-- name: ReserveLoginAttempt :one
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES (sqlc.arg(key), 1, NOW())
+ON CONFLICT (key) DO UPDATE SET
+  failures = CASE
+    WHEN login_throttles.last_failure_at < sqlc.arg(forget_before) THEN 1
+    ELSE login_throttles.failures + 1
+  END,
+  last_failure_at = NOW(),
+  previous_failure_at = login_throttles.last_failure_at
+WHERE login_throttles.last_failure_at < sqlc.arg(forget_before)
+  OR login_throttles.last_failure_at + make_interval(secs => COALESCE(
+    (sqlc.arg(delays)::float8[])[LEAST(login_throttles.failures, cardinality(sqlc.arg(delays)::float8[]))], 0
+  )) <= NOW()
+RETURNING *;
+
+-- name: ReleaseLoginAttempt :exec
+-- the last failure is only put back while no later attempt has been reserved
+UPDATE login_throttles SET
+  failures = failures - 1,
+  last_failure_at = CASE
+    WHEN last_failure_at = sqlc.arg(reserved_at) THEN COALESCE(previous_failure_at, last_failure_at)
+    ELSE last_failure_at
+  END
+WHERE key = sqlc.arg(key) AND failures > 0;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles WHERE key = $1;
@@ -0,0 +1,12 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, user_id, expires_at, created_at)
+VALUES ($1, $2, $3, NOW());
+
+-- name: DeleteMagicLinkTokensByUser :exec
+DELETE FROM magic_link_tokens WHERE user_id = $1;
+
+-- name: ConsumeMagicLinkToken :one
+DELETE FROM magic_link_tokens WHERE token_hash = $1 RETURNING *;
+
+-- name: DeleteExpiredMagicLinkTokens :exec
+DELETE FROM magic_link_tokens WHERE expires_at < NOW();
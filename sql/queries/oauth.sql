@@ -0,0 +1,53 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, scopes, owner_id, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW())
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: GetOAuthClientsByOwner :many
+SELECT * FROM oauth_clients WHERE owner_id = $1 ORDER BY created_at;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, scopes, redirect_uri, code_challenge, code_challenge_method, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: GetAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes WHERE code_hash = $1;
+
+-- name: UseAuthorizationCode :execrows
+UPDATE oauth_authorization_codes SET used_at = NOW(), grant_id = $2
+WHERE code_hash = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes WHERE expires_at < NOW();
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (id, client_id, user_id, scopes, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+RETURNING *;
+
+-- name: GetOAuthGrant :one
+SELECT * FROM oauth_grants WHERE id = $1;
+
+-- name: GetOAuthGrantsByUser :many
+SELECT oauth_grants.*, oauth_clients.name AS client_name
+FROM oauth_grants
+JOIN oauth_clients ON oauth_clients.id = oauth_grants.client_id
+WHERE oauth_grants.user_id = $1 AND oauth_grants.revoked_at IS NULL
+ORDER BY oauth_grants.created_at;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_grants SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeGrantRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE grant_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserOAuthGrants :exec
+UPDATE oauth_grants SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,30 @@
+-- name: CreatePasskey :one
+INSERT INTO passkeys (id, user_id, credential_id, public_key, sign_count, transports, name, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW())
+RETURNING *;
+
+-- name: GetPasskeysByUser :many
+SELECT * FROM passkeys WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetPasskeyByCredentialID :one
+SELECT * FROM passkeys WHERE credential_id = $1;
+
+-- name: UpdatePasskeySignCount :exec
+UPDATE passkeys SET sign_count = $2, last_used_at = NOW() WHERE id = $1;
+
+-- name: DeletePasskey :execrows
+DELETE FROM passkeys WHERE id = $1 AND user_id = $2;
+
+-- name: CountPasskeys :one
+SELECT COUNT(*) FROM passkeys WHERE user_id = $1;
+
+-- name: CreatePasskeyChallenge :one
+INSERT INTO passkey_challenges (id, user_id, purpose, challenge, expires_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4)
+RETURNING *;
+
+-- name: ConsumePasskeyChallenge :one
+DELETE FROM passkey_challenges WHERE id = $1 RETURNING *;
+
+-- name: DeleteExpiredPasskeyChallenges :exec
+DELETE FROM passkey_challenges WHERE expires_at < NOW();
@@ -0,0 +1,10 @@
+-- name: PinChirp :exec
+INSERT INTO pinned_chirps (chirp_id, user_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (chirp_id) DO NOTHING;
+
+-- name: UnpinChirp :execrows
+DELETE FROM pinned_chirps WHERE chirp_id = $1 AND user_id = $2;
+
+-- name: GetPinnedChirpIDs :many
+SELECT chirp_id FROM pinned_chirps WHERE user_id = $1 ORDER BY created_at DESC;
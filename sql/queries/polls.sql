@@ -0,0 +1,42 @@
+-- name: CreatePoll :one
+INSERT INTO polls (id, chirp_id, created_at, expires_at)
+VALUES (gen_random_uuid(), $1, NOW(), $2)
+RETURNING *;
+
+-- name: CreatePollOption :one
+INSERT INTO poll_options (id, poll_id, position, text)
+VALUES (gen_random_uuid(), $1, $2, $3)
+RETURNING *;
+
+-- name: GetPollByChirpID :one
+SELECT * FROM polls WHERE chirp_id = $1;
+
+-- name: GetPollsByChirpIDs :many
+SELECT * FROM polls WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetPollOptionsWithVotes :many
+SELECT poll_options.id, poll_options.position, poll_options.text, COUNT(poll_votes.user_id) AS votes
+FROM poll_options
+LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+WHERE poll_options.poll_id = $1
+GROUP BY poll_options.id
+ORDER BY poll_options.position;
+
+-- name: GetPollOptionsWithVotesByPollIDs :many
+SELECT poll_options.id, poll_options.poll_id, poll_options.position, poll_options.text, COUNT(poll_votes.user_id) AS votes
+FROM poll_options
+LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+WHERE poll_options.poll_id = ANY(sqlc.arg(poll_ids)::uuid[])
+GROUP BY poll_options.id
+ORDER BY poll_options.poll_id, poll_options.position;
+
+-- name: GetPollVote :one
+SELECT * FROM poll_votes WHERE poll_id = $1 AND user_id = $2;
+
+-- name: GetPollVotesByUser :many
+SELECT * FROM poll_votes WHERE poll_id = ANY(sqlc.arg(poll_ids)::uuid[]) AND user_id = sqlc.arg(user_id);
+
+-- name: CreatePollVote :one
+INSERT INTO poll_votes (poll_id, option_id, user_id, created_at)
+VALUES ($1, $2, $3, NOW())
+RETURNING *;
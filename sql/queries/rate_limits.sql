@@ -0,0 +1,15 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(capacity)::float8 - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE SET
+  tokens = CASE
+    WHEN LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_per_second)::float8) >= 1
+    THEN LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_per_second)::float8) - 1
+    ELSE LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_per_second)::float8)
+  END,
+  allowed = LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_per_second)::float8) >= 1,
+  updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: DeleteStaleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets WHERE updated_at < $1;
@@ -1,6 +1,6 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, grant_id)
+VALUES ($1, NOW(), NOW(), $2, $3, $4)
 RETURNING *;
 
 -- name: GetToken :one
@@ -10,4 +10,14 @@ SELECT * FROM refresh_tokens WHERE token = $1;
 UPDATE refresh_tokens 
 SET revoked_at = $1, updated_at = $2
 WHERE token = $3 
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: RevokeUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: GetActiveRefreshTokens :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC;
@@ -0,0 +1,45 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, reporter_id, reported_user_id, chirp_id, chirp_body, category, details, status, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, 'open', NOW(), NOW())
+RETURNING *;
+
+-- name: GetReports :many
+SELECT * FROM reports
+WHERE (sqlc.arg(status)::text = '' OR status = sqlc.arg(status)::text)
+ORDER BY created_at ASC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: GetReportByID :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed', claimed_by = $2, claimed_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: CloseReport :one
+UPDATE reports
+SET status = $2, closed_by = $3, closed_at = NOW(), resolution_note = $4, updated_at = NOW()
+WHERE id = $1 AND status = 'claimed' AND claimed_by = $3
+RETURNING *;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, report_id, moderator_id, target_user_id, chirp_id, action, note, suspended_until, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, NOW())
+RETURNING *;
+
+-- name: GetModerationActionsByReport :many
+SELECT * FROM moderation_actions WHERE report_id = $1 ORDER BY created_at;
+
+-- name: CountReportsByStatus :one
+SELECT COUNT(*) FROM reports WHERE status = $1;
+
+-- name: AnonymizeReports :exec
+-- the details a reporter typed and the reported chirp's body go with the
+-- account they came from or are about
+UPDATE reports
+SET details = '',
+  chirp_body = CASE WHEN reported_user_id = sqlc.arg(user_id)::uuid THEN '' ELSE chirp_body END,
+  updated_at = NOW()
+WHERE reporter_id = sqlc.arg(user_id)::uuid OR reported_user_id = sqlc.arg(user_id)::uuid;
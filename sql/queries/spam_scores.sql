@@ -0,0 +1,20 @@
+-- name: CreateSpamScore :one
+INSERT INTO spam_scores (id, chirp_id, user_id, body, score, verdict, signals, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW())
+RETURNING *;
+
+-- name: GetSpamScores :many
+SELECT * FROM spam_scores
+WHERE (sqlc.arg(verdict)::text = '' OR verdict = sqlc.arg(verdict)::text)
+  AND (NOT sqlc.arg(unreviewed)::boolean OR reviewed_at IS NULL)
+ORDER BY created_at DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: GetSpamScoreByID :one
+SELECT * FROM spam_scores WHERE id = $1;
+
+-- name: ReviewSpamScore :one
+UPDATE spam_scores
+SET review_outcome = $2, reviewed_by = $3, reviewed_at = NOW()
+WHERE id = $1 AND reviewed_at IS NULL
+RETURNING *;
@@ -0,0 +1,11 @@
+-- name: GetUserPreferences :one
+SELECT * FROM user_preferences WHERE user_id = $1;
+
+-- name: UpsertUserPreferences :one
+INSERT INTO user_preferences (user_id, always_expand, hide_sensitive_media, updated_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET always_expand = EXCLUDED.always_expand,
+  hide_sensitive_media = EXCLUDED.hide_sensitive_media,
+  updated_at = NOW()
+RETURNING *;
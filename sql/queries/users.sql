@@ -3,17 +3,70 @@ INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
 RETURNING *;
 
+-- name: CreateFederatedUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, has_password)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, FALSE)
+RETURNING *;
+
 -- name: DeleteUsers :exec
 DELETE FROM users; 
 
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
--- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3 WHERE id = $1 RETURNING *;
+-- name: UpdatePassword :one
+UPDATE users SET hashed_password = $2, password_reset_required = FALSE, has_password = TRUE, updated_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: UpdateEmail :one
+UPDATE users SET email = $2, updated_at = NOW() WHERE id = $1 RETURNING *;
 
 -- name: UpgradeUserToChirpyRed :exec
 UPDATE users SET is_chirpy_red = TRUE WHERE id = $1; 
 
 -- name: DowngradeUserFromChirpyRed :exec
-UPDATE users SET is_chirpy_red = FALSE WHERE id = $1; 
\ No newline at end of file
+UPDATE users SET is_chirpy_red = FALSE WHERE id = $1; 
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: GetUserByIDForUpdate :one
+SELECT * FROM users WHERE id = $1 FOR UPDATE;
+
+-- name: SetAccountState :one
+UPDATE users SET account_state = $2, state_expires_at = $3, updated_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE email ILIKE '%' || sqlc.arg(query)::text || '%'
+ORDER BY email
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM users;
+
+-- name: RequirePasswordReset :exec
+UPDATE users SET password_reset_required = TRUE, updated_at = NOW() WHERE id = $1;
+
+-- name: SetPostingCooldown :exec
+UPDATE users SET posting_cooldown_until = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: UpdatePasswordHash :exec
+UPDATE users SET hashed_password = $2 WHERE id = $1;
+
+-- name: SetPasskeyRequired :exec
+UPDATE users SET passkey_required = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: SetDeleteAfter :exec
+UPDATE users SET delete_after = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: GetUsersDueForDeletion :many
+SELECT * FROM users WHERE delete_after <= NOW() ORDER BY delete_after LIMIT $1;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1;
+
+-- name: RevokeAccessTokens :exec
+UPDATE users SET tokens_valid_after = NOW(), updated_at = NOW() WHERE id = $1;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE bookmarks(
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  collection TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX bookmarks_user_collection_idx ON bookmarks(user_id, collection, created_at);
+
+-- +goose Down
+DROP TABLE bookmarks;
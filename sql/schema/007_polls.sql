@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE polls(
+  id UUID PRIMARY KEY,
+  chirp_id UUID NOT NULL UNIQUE REFERENCES chirps(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE poll_options(
+  id UUID PRIMARY KEY,
+  poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  text TEXT NOT NULL,
+  UNIQUE (poll_id, position)
+);
+
+CREATE TABLE poll_votes(
+  poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+  option_id UUID NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  CONSTRAINT poll_votes_one_per_user UNIQUE (poll_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE poll_votes;
+DROP TABLE poll_options;
+DROP TABLE polls;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- pins are removed along with their chirp
+CREATE TABLE pinned_chirps(
+  chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX pinned_chirps_user_idx ON pinned_chirps(user_id);
+
+-- +goose Down
+DROP TABLE pinned_chirps;
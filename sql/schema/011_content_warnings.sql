@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN spoiler_text TEXT NOT NULL DEFAULT '',
+ADD COLUMN sensitive BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+ADD COLUMN is_moderator BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE user_preferences(
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  always_expand BOOLEAN NOT NULL DEFAULT FALSE,
+  hide_sensitive_media BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE user_preferences;
+
+ALTER TABLE users
+DROP COLUMN is_moderator;
+
+ALTER TABLE chirps
+DROP COLUMN spoiler_text,
+DROP COLUMN sensitive;
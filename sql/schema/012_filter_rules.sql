@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE filter_rules(
+  id UUID PRIMARY KEY,
+  word TEXT NOT NULL UNIQUE,
+  action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag')),
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE chirp_flags(
+  id UUID PRIMARY KEY,
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  source TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE chirp_flags;
+DROP TABLE filter_rules;
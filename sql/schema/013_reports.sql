@@ -0,0 +1,57 @@
+-- +goose Up
+CREATE TABLE reports(
+  id UUID PRIMARY KEY,
+  reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  reported_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  -- the chirp may be removed as a result of the report, so its body is kept
+  chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+  chirp_body TEXT NOT NULL DEFAULT '',
+  category TEXT NOT NULL
+    CHECK (category IN ('spam', 'harassment', 'hate', 'violence', 'sexual', 'self_harm', 'misinformation', 'other')),
+  details TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved', 'dismissed')),
+  claimed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  claimed_at TIMESTAMP,
+  closed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  closed_at TIMESTAMP,
+  resolution_note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX reports_status_idx ON reports(status, created_at);
+
+CREATE TABLE moderation_actions(
+  id UUID PRIMARY KEY,
+  report_id UUID NOT NULL REFERENCES reports(id) ON DELETE CASCADE,
+  moderator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  target_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  chirp_id UUID,
+  action TEXT NOT NULL CHECK (action IN ('remove_chirp', 'warn', 'suspend_user')),
+  note TEXT NOT NULL DEFAULT '',
+  suspended_until TIMESTAMP,
+  created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP;
+
+CREATE TABLE notifications(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  message TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  read_at TIMESTAMP
+);
+
+CREATE INDEX notifications_user_idx ON notifications(user_id, created_at);
+
+-- +goose Down
+DROP TABLE notifications;
+
+ALTER TABLE users
+DROP COLUMN suspended_until;
+
+DROP TABLE moderation_actions;
+DROP TABLE reports;
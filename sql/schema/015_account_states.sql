@@ -0,0 +1,40 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN account_state TEXT NOT NULL DEFAULT 'active'
+  CHECK (account_state IN ('active', 'suspended', 'shadowbanned', 'deactivated')),
+-- suspensions and shadowbans can end on their own; the state reads as active after this time
+ADD COLUMN state_expires_at TIMESTAMP;
+
+UPDATE users
+SET account_state = 'suspended', state_expires_at = suspended_until
+WHERE suspended_until > NOW();
+
+ALTER TABLE users
+DROP COLUMN suspended_until;
+
+CREATE TABLE account_state_transitions(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  from_state TEXT NOT NULL,
+  to_state TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  expires_at TIMESTAMP,
+  actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX account_state_transitions_user_idx ON account_state_transitions(user_id, created_at);
+
+-- +goose Down
+DROP TABLE account_state_transitions;
+
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP;
+
+UPDATE users
+SET suspended_until = state_expires_at
+WHERE account_state = 'suspended';
+
+ALTER TABLE users
+DROP COLUMN account_state,
+DROP COLUMN state_expires_at;
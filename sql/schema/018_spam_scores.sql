@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN held BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX chirps_user_created_at_idx ON chirps(user_id, created_at);
+CREATE INDEX chirps_body_hash_idx ON chirps(md5(lower(body)));
+
+ALTER TABLE users
+ADD COLUMN posting_cooldown_until TIMESTAMP;
+
+CREATE TABLE spam_scores(
+  id UUID PRIMARY KEY,
+  -- NULL when the chirp was refused or has since been removed
+  chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  score DOUBLE PRECISION NOT NULL,
+  verdict TEXT NOT NULL CHECK (verdict IN ('allow', 'hold', 'rate_limit', 'reject')),
+  signals JSONB NOT NULL DEFAULT '[]',
+  review_outcome TEXT NOT NULL DEFAULT '' CHECK (review_outcome IN ('', 'approved', 'removed')),
+  reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  reviewed_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX spam_scores_review_idx ON spam_scores(reviewed_at, created_at);
+
+-- +goose Down
+DROP TABLE spam_scores;
+
+ALTER TABLE users
+DROP COLUMN posting_cooldown_until;
+
+DROP INDEX chirps_body_hash_idx;
+DROP INDEX chirps_user_created_at_idx;
+
+ALTER TABLE chirps
+DROP COLUMN held;
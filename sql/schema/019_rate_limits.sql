@@ -0,0 +1,15 @@
+-- +goose Up
+-- token buckets shared by all replicas. Buckets are refilled using the
+-- database clock so replicas agree on the time.
+CREATE TABLE rate_limit_buckets(
+  key TEXT PRIMARY KEY,
+  tokens DOUBLE PRECISION NOT NULL,
+  -- whether the last request was let through
+  allowed BOOLEAN NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets(updated_at);
+
+-- +goose Down
+DROP TABLE rate_limit_buckets;
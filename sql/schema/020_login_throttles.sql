@@ -0,0 +1,10 @@
+-- +goose Up
+-- failed logins per account (keyed by email) and per IP address
+CREATE TABLE login_throttles(
+  key TEXT PRIMARY KEY,
+  failures INTEGER NOT NULL,
+  last_failure_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,43 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+  id TEXT PRIMARY KEY,
+  -- NULL for public clients, which cannot keep a secret and rely on PKCE alone
+  secret_hash TEXT,
+  name TEXT NOT NULL,
+  redirect_uris TEXT[] NOT NULL,
+  scopes TEXT[] NOT NULL,
+  owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL
+);
+
+-- a user's permission for a client to act for them
+CREATE TABLE oauth_grants(
+  id UUID PRIMARY KEY,
+  client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  scopes TEXT[] NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP
+);
+
+CREATE TABLE oauth_authorization_codes(
+  code_hash TEXT PRIMARY KEY,
+  client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  scopes TEXT[] NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  code_challenge TEXT NOT NULL,
+  code_challenge_method TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE refresh_tokens
+ADD COLUMN grant_id UUID REFERENCES oauth_grants(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN grant_id;
+
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_grants;
+DROP TABLE oauth_clients;
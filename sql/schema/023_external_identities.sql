@@ -0,0 +1,31 @@
+-- +goose Up
+-- users who signed up through an external provider have a random password until they choose one
+ALTER TABLE users
+ADD COLUMN has_password BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE TABLE external_identities(
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  last_login_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (provider, subject),
+  UNIQUE (user_id, provider)
+);
+
+-- logins in progress, between the redirect to the provider and the callback
+CREATE TABLE oidc_login_states(
+  state_hash TEXT PRIMARY KEY,
+  provider TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  code_verifier TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE external_identities;
+
+ALTER TABLE users
+DROP COLUMN has_password;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- only a SHA-256 hash of each link's token is kept, and only the newest link of a user works
+CREATE TABLE magic_link_tokens(
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX magic_link_tokens_user_id_idx ON magic_link_tokens(user_id);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
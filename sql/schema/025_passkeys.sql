@@ -0,0 +1,35 @@
+-- +goose Up
+-- users who turn this on need a passkey as well as their password to log in
+ALTER TABLE users
+ADD COLUMN passkey_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE passkeys(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  credential_id BYTEA NOT NULL UNIQUE,
+  -- the credential's COSE_Key
+  public_key BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL,
+  transports TEXT[] NOT NULL,
+  name TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP
+);
+
+CREATE INDEX passkeys_user_id_idx ON passkeys(user_id);
+
+-- ceremonies in progress, user_id is empty for passwordless logins
+CREATE TABLE passkey_challenges(
+  id UUID PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  purpose TEXT NOT NULL,
+  challenge TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE passkey_challenges;
+DROP TABLE passkeys;
+
+ALTER TABLE users
+DROP COLUMN passkey_required;
@@ -0,0 +1,51 @@
+-- +goose Up
+-- accounts whose owner asked for deletion are deleted once delete_after has passed
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMP;
+
+CREATE INDEX users_delete_after_idx ON users(delete_after) WHERE delete_after IS NOT NULL;
+
+CREATE TABLE data_exports(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+  -- where the archive is stored while it can be downloaded
+  file_path TEXT NOT NULL DEFAULT '',
+  size_bytes BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL,
+  started_at TIMESTAMP,
+  completed_at TIMESTAMP,
+  expires_at TIMESTAMP
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports(user_id, created_at);
+CREATE INDEX data_exports_pending_idx ON data_exports(created_at) WHERE status = 'pending';
+
+-- deleting an account may scrub the personal data in its audit events, but
+-- events can still never be removed or reworded
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' AND current_setting('chirpy.anonymizing', true) = 'on'
+    AND NEW.id = OLD.id AND NEW.action = OLD.action AND NEW.created_at = OLD.created_at
+    AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id AND NEW.target_id IS NOT DISTINCT FROM OLD.target_id THEN
+    RETURN NEW;
+  END IF;
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TABLE data_exports;
+
+ALTER TABLE users
+DROP COLUMN delete_after;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- an email change waits here until the link sent to the new address is opened.
+-- only a SHA-256 hash of each link's token is kept, and only the newest link of a user works
+CREATE TABLE email_change_tokens(
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  new_email TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX email_change_tokens_user_id_idx ON email_change_tokens(user_id);
+
+-- +goose Down
+DROP TABLE email_change_tokens;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- access tokens issued before this time are refused, so revoking a user's
+-- sessions does not wait for their access tokens to expire
+ALTER TABLE users
+ADD COLUMN tokens_valid_after TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN tokens_valid_after;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- used codes are kept until they expire so a second use can be caught, and
+-- the grant issued for them revoked
+ALTER TABLE oauth_authorization_codes
+ADD COLUMN used_at TIMESTAMP,
+ADD COLUMN grant_id UUID REFERENCES oauth_grants(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes
+DROP COLUMN used_at,
+DROP COLUMN grant_id;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- the link emailed when an account is scheduled for deletion restores it
+-- without a password. only a SHA-256 hash of each link's token is kept
+CREATE TABLE account_restore_tokens(
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX account_restore_tokens_user_id_idx ON account_restore_tokens(user_id);
+
+-- +goose Down
+DROP TABLE account_restore_tokens;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- whether viewer may see chirp. every query that shows chirps to someone uses
+-- it, so a change to the rules reaches all of them. viewer is the nil UUID for
+-- anonymous requests
+-- +goose StatementBegin
+CREATE FUNCTION chirp_visible_to(chirp chirps, viewer UUID) RETURNS BOOLEAN AS $$
+  SELECT chirp.user_id = viewer OR (NOT chirp.held AND NOT EXISTS (
+    SELECT 1 FROM users WHERE users.id = chirp.user_id AND users.account_state = 'shadowbanned'
+      AND (users.state_expires_at IS NULL OR users.state_expires_at > NOW())
+  ) AND (
+    chirp.visibility = 'public'
+    OR (chirp.visibility = 'followers' AND EXISTS (
+      SELECT 1 FROM follows WHERE follows.follower_id = viewer AND follows.followee_id = chirp.user_id))
+    OR (chirp.visibility = 'mentioned' AND EXISTS (
+      SELECT 1 FROM chirp_mentions WHERE chirp_mentions.chirp_id = chirp.id AND chirp_mentions.user_id = viewer))
+  ))
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION chirp_visible_to(chirps, UUID);
@@ -0,0 +1,33 @@
+-- +goose Up
+-- reports and moderation actions outlive the accounts they are about, so a
+-- user cannot wipe their record by deleting their account. deleteAccount
+-- scrubs the text in them that says something about the person
+ALTER TABLE reports
+ALTER COLUMN reporter_id DROP NOT NULL,
+ALTER COLUMN reported_user_id DROP NOT NULL,
+DROP CONSTRAINT reports_reporter_id_fkey,
+DROP CONSTRAINT reports_reported_user_id_fkey,
+ADD CONSTRAINT reports_reporter_id_fkey FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE SET NULL,
+ADD CONSTRAINT reports_reported_user_id_fkey FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE moderation_actions
+ALTER COLUMN target_user_id DROP NOT NULL,
+DROP CONSTRAINT moderation_actions_target_user_id_fkey,
+ADD CONSTRAINT moderation_actions_target_user_id_fkey FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- +goose Down
+DELETE FROM moderation_actions WHERE target_user_id IS NULL;
+DELETE FROM reports WHERE reporter_id IS NULL OR reported_user_id IS NULL;
+
+ALTER TABLE moderation_actions
+DROP CONSTRAINT moderation_actions_target_user_id_fkey,
+ADD CONSTRAINT moderation_actions_target_user_id_fkey FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE CASCADE,
+ALTER COLUMN target_user_id SET NOT NULL;
+
+ALTER TABLE reports
+DROP CONSTRAINT reports_reporter_id_fkey,
+DROP CONSTRAINT reports_reported_user_id_fkey,
+ADD CONSTRAINT reports_reporter_id_fkey FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+ADD CONSTRAINT reports_reported_user_id_fkey FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE CASCADE,
+ALTER COLUMN reporter_id SET NOT NULL,
+ALTER COLUMN reported_user_id SET NOT NULL;
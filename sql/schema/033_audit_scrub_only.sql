@@ -0,0 +1,40 @@
+-- +goose Up
+-- the only change an audit event allows is scrubbing it once a user it
+-- mentions has been deleted: its ip and user agent can be emptied and
+-- metadata keys removed, but nothing can be reworded. unlike a setting any
+-- session could turn on, this cannot be used on events of existing users
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.id = OLD.id AND NEW.action = OLD.action AND NEW.created_at = OLD.created_at
+    AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id AND NEW.target_id IS NOT DISTINCT FROM OLD.target_id
+    AND NEW.ip IN ('', OLD.ip) AND NEW.user_agent IN ('', OLD.user_agent)
+    AND NOT EXISTS (
+      SELECT 1 FROM jsonb_each(NEW.metadata) kept
+      WHERE OLD.metadata -> kept.key IS DISTINCT FROM kept.value
+    )
+    AND (
+      (OLD.actor_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = OLD.actor_id))
+      OR (OLD.target_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = OLD.target_id))
+    ) THEN
+    RETURN NEW;
+  END IF;
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' AND current_setting('chirpy.anonymizing', true) = 'on'
+    AND NEW.id = OLD.id AND NEW.action = OLD.action AND NEW.created_at = OLD.created_at
+    AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id AND NEW.target_id IS NOT DISTINCT FROM OLD.target_id THEN
+    RETURN NEW;
+  END IF;
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
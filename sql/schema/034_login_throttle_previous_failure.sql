@@ -0,0 +1,6 @@
+-- +goose Up
+-- the last failure before a reserved attempt, restored if the attempt is released
+ALTER TABLE login_throttles ADD COLUMN previous_failure_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE login_throttles DROP COLUMN previous_failure_at;
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaeanthony/chirpy/internal/auth"
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// personalAccessJWTTTL is how long the access token a personal access token
+// is exchanged for lives. It never leaves the server so it only has to last
+// for one request.
+const personalAccessJWTTTL = time.Minute
+
+type PersonalAccessToken struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Token is only returned when the token is created
+	Token      string     `json:"token,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// ExpiresInSeconds is optional, tokens without it never expire
+		ExpiresInSeconds int `json:"expires_in_seconds"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	const maxNameLength = 100
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxNameLength {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("name must be 1 to %d characters", maxNameLength))
+		return
+	}
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(scopes) == 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("at least one scope is required"))
+		return
+	}
+	if params.ExpiresInSeconds < 0 {
+		WriteError(w, http.StatusBadRequest, errors.New("expires_in_seconds cannot be negative"))
+		return
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInSeconds > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(params.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+
+	pat, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create token: %v", err))
+		return
+	}
+
+	dbToken, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userId,
+		Name:      params.Name,
+		TokenHash: hashToken(pat),
+		Scopes:    scopeNames(scopes),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create token: %v", err))
+		return
+	}
+
+	resp := personalAccessTokenFromDB(dbToken)
+	resp.Token = pat
+	WriteJSON(w, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) handlerGetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	dbTokens, err := cfg.db.GetPersonalAccessTokens(r.Context(), userId)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("couldn't retrieve tokens: %v", err))
+		return
+	}
+
+	tokens := []PersonalAccessToken{}
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, personalAccessTokenFromDB(dbToken))
+	}
+
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) handlerDeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("token required: %v", err))
+		return
+	}
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	tokenId, err := uuid.Parse(r.PathValue("tokenId"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse token id: %v", err))
+		return
+	}
+
+	n, err := cfg.db.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{ID: tokenId, UserID: userId})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete token: %v", err))
+		return
+	}
+	if n == 0 {
+		WriteError(w, http.StatusNotFound, errors.New("token not found"))
+		return
+	}
+
+	cfg.recordAudit(r, auditTokenRevoked, userId, userId, map[string]any{"personal_access_token_id": tokenId})
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// middlewarePersonalAccessTokens swaps a personal access token in the
+// Authorization header for a short-lived access token limited to its scopes,
+// so every handler that accepts access tokens accepts personal access tokens
+// too.
+func (cfg *apiConfig) middlewarePersonalAccessTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil || !auth.IsPersonalAccessToken(token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pat, err := cfg.db.GetPersonalAccessTokenByHash(r.Context(), hashToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			WriteError(w, http.StatusUnauthorized, errors.New("invalid personal access token"))
+			return
+		} else if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to get personal access token: %v", err))
+			return
+		}
+		if pat.ExpiresAt.Valid && pat.ExpiresAt.Time.Before(time.Now()) {
+			WriteError(w, http.StatusUnauthorized, errors.New("personal access token has expired"))
+			return
+		}
+
+		scopes, err := auth.ParseScopes(strings.Join(pat.Scopes, " "))
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("invalid token scopes: %v", err))
+			return
+		}
+		// personal access tokens never reach staff routes, so the role does not matter
+		jwt, err := auth.MakePersonalAccessJWT(pat.UserID, auth.RoleUser, pat.ID, scopes, cfg.jwtSecret, personalAccessJWTTTL)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to create token: %v", err))
+			return
+		}
+
+		if err := cfg.db.TouchPersonalAccessToken(r.Context(), pat.ID); err != nil {
+			log.Printf("failed to update last use of personal access token %s: %v", pat.ID, err)
+		}
+
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+jwt)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// helpers ---------------------------------------------------------
+
+func personalAccessTokenFromDB(token database.PersonalAccessToken) PersonalAccessToken {
+	t := PersonalAccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		t.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		t.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return t
+}
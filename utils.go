@@ -1,8 +1,18 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 func WriteJSON(w http.ResponseWriter, status int, v any) error {
@@ -13,4 +23,56 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 
 func WriteError(w http.ResponseWriter, status int, err error) {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
-}
\ No newline at end of file
+}
+
+// setRetryAfter tells the client when it may try again.
+func setRetryAfter(w http.ResponseWriter, until time.Time) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+// parsePagination reads the optional limit and offset url parameters.
+func parsePagination(r *http.Request) (limit, offset int32, err error) {
+	const defaultLimit = 20
+	const maxLimit = 100
+
+	limit = defaultLimit
+	if str := r.URL.Query().Get("limit"); str != "" {
+		n, err := strconv.Atoi(str)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", str)
+		}
+		limit = int32(min(n, maxLimit))
+	}
+
+	if str := r.URL.Query().Get("offset"); str != "" {
+		n, err := strconv.ParseInt(str, 10, 32)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", str)
+		}
+		offset = int32(n)
+	}
+
+	return limit, offset, nil
+}
+
+// isUniqueViolation reports whether err is a postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken hashes a random secret for storage. Secrets have enough entropy
+// that a slow password hash is not needed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chaeanthony/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	visibilityPublic    = "public"
+	visibilityFollowers = "followers"
+	visibilityMentioned = "mentioned"
+)
+
+func validateVisibility(visibility string) (string, error) {
+	switch visibility {
+	case "":
+		return visibilityPublic, nil
+	case visibilityPublic, visibilityFollowers, visibilityMentioned:
+		return visibility, nil
+	}
+	return "", fmt.Errorf("invalid visibility %q. expected public, followers or mentioned", visibility)
+}
+
+// getVisibleChirp fetches a chirp, returning sql.ErrNoRows if the viewer may
+// not see it. Handlers respond with 404 for chirps the viewer cannot see so
+// their existence is not revealed.
+func (cfg *apiConfig) getVisibleChirp(ctx context.Context, chirpID, viewerID uuid.UUID) (database.Chirp, error) {
+	return cfg.db.GetVisibleChirpById(ctx, database.GetVisibleChirpByIdParams{ID: chirpID, ViewerID: viewerID})
+}
@@ -54,5 +54,7 @@ func (cfg *apiConfig) handlerUpgradeUserToRed(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	cfg.recordAudit(r, auditChirpyRedUpgraded, uuid.Nil, userId, map[string]any{"event": params.Event, "source": "polka"})
+
 	WriteJSON(w, http.StatusNoContent, nil)
 }
\ No newline at end of file